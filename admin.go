@@ -12,3 +12,14 @@ type AdminResource struct {
 func (api AdminResource) Get() (int, interface{}) {
 	return http.StatusOK, nil
 }
+
+//An admin REST resource listing the routes of an API as JSON.
+//Example: api.AddResource("/admin/routes", pastis.RoutesResource{api})
+type RoutesResource struct {
+	API *API
+}
+
+//GETs the description of the API routes
+func (resource RoutesResource) Get() (int, interface{}) {
+	return http.StatusOK, resource.API.Routes()
+}
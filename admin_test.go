@@ -1,9 +1,11 @@
 package pastis
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -23,3 +25,33 @@ func Test_Pastis_AdminResource_Handler(t *testing.T) {
 	}
 	expect(t, res.StatusCode, http.StatusOK)
 }
+
+func Test_Pastis_RoutesResource_Handler(t *testing.T) {
+	p := NewAPI()
+	p.AddFilter(LoggingFilter)
+	p.AddResource("/ping", new(AdminResource), Name("ping"))
+	p.Group("/admin", CORSFilter).AddResource("/routes", RoutesResource{p})
+	p.HandleFunc()
+
+	ts := httptest.NewServer(p)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/admin/routes")
+	if err != nil {
+		log.Fatal(err)
+	}
+	expect(t, res.StatusCode, http.StatusOK)
+	var routes []RouteInfo
+	if err := json.NewDecoder(res.Body).Decode(&routes); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, len(routes), 2)
+	expect(t, routes[0].Method, "GET")
+	expect(t, routes[0].Pattern, "/admin/routes")
+	expect(t, routes[0].Handler, "pastis.RoutesResource.Get")
+	expect(t, strings.Join(routes[0].Filters, ","), funcName(LoggingFilter)+","+funcName(CORSFilter))
+	expect(t, routes[1].Pattern, "/ping")
+	expect(t, routes[1].Name, "ping")
+	expect(t, routes[1].Handler, "*pastis.AdminResource.Get")
+	expect(t, strings.Contains(routes[1].Source, "admin_test.go:"), true)
+}
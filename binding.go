@@ -0,0 +1,318 @@
+package pastis
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+//Sources of the parameters bound to the fields of a parameter struct, named after their field tag
+var paramSources = []string{"path", "query", "header"}
+
+//Types converted apart from their kind
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// A ParamError tells why a request parameter cannot be bound to the field of a parameter struct.
+type ParamError struct {
+	//Source of the parameter: path, query or header
+	In string `json:"in"`
+	//Name of the parameter
+	Name string `json:"name"`
+	//Reason of the error
+	Detail string `json:"detail"`
+}
+
+//fieldBinder sets a field of a parameter struct from a request parameter.
+type fieldBinder struct {
+	//offset of the field in the struct
+	offset uintptr
+	//source and name of the parameter
+	in   string
+	name string
+	//value used when the request has no such parameter, if any
+	defaultValue *string
+	convert      converter
+}
+
+//A converter sets the value at p from the values of a request parameter.
+type converter func(values []string, p unsafe.Pointer) error
+
+//isParamStruct reports whether a callback argument is a parameter struct, that is a struct having fields tagged path, query or header.
+func isParamStruct(argType reflect.Type) bool {
+	if argType.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < argType.NumField(); i++ {
+		for _, in := range paramSources {
+			if _, ok := argType.Field(i).Tag.Lookup(in); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//paramResolver returns the resolver of a parameter struct argument, checking the binding of every tagged field.
+//The resolver fails with a 400 Bad Request problem listing every parameter that cannot be converted,
+//and then with the Violations of the parameter struct (see newValidator).
+func paramResolver(paramType reflect.Type) (argumentResolver, error) {
+	validator, err := newValidator(paramType)
+	if err != nil {
+		return nil, err
+	}
+	binder, err := newParamBinder(paramType)
+	if err != nil {
+		return nil, err
+	}
+	return func(rw http.ResponseWriter, request *http.Request) (reflect.Value, error) {
+		params := reflect.New(paramType)
+		if err := binder.bind(request, params.UnsafePointer()); err != nil {
+			return params.Elem(), err
+		}
+		if validator != nil {
+			var violations Violations
+			validator(params.UnsafePointer(), "", &violations)
+			if len(violations) > 0 {
+				binder.locate(violations)
+				return params.Elem(), violations
+			}
+		}
+		return params.Elem(), nil
+	}, nil
+}
+
+//paramBinder binds the tagged fields of a parameter struct to the request parameters.
+type paramBinder struct {
+	fields []fieldBinder
+	//sources of the parameters by name, as located by the violations
+	sources map[string]string
+}
+
+//newParamBinder returns the binder of the tagged fields of a parameter struct.
+func newParamBinder(paramType reflect.Type) (*paramBinder, error) {
+	b := &paramBinder{sources: make(map[string]string)}
+	for i := 0; i < paramType.NumField(); i++ {
+		field := paramType.Field(i)
+		binder, ok, err := newFieldBinder(field)
+		if err != nil {
+			return nil, fmt.Errorf("field %s of %v: %v", field.Name, paramType, err)
+		}
+		if ok {
+			b.fields = append(b.fields, binder)
+			b.sources[escapePointer(fieldName(field))] = binder.in
+		}
+	}
+	return b, nil
+}
+
+//bind sets the fields of the parameter struct at p from the request parameters. It returns a 400 Bad Request problem listing
+//every parameter that cannot be converted.
+func (b *paramBinder) bind(request *http.Request, p unsafe.Pointer) error {
+	var query url.Values
+	var errs []ParamError
+	for _, binder := range b.fields {
+		var values []string
+		switch binder.in {
+		case "path":
+			if value := request.PathValue(binder.name); value != "" {
+				values = []string{value}
+			}
+		case "query":
+			if query == nil {
+				query = request.URL.Query()
+			}
+			values = query[binder.name]
+		case "header":
+			values = request.Header.Values(binder.name)
+		}
+		if len(values) == 0 {
+			if binder.defaultValue == nil {
+				continue
+			}
+			values = []string{*binder.defaultValue}
+		}
+		if err := binder.convert(values, unsafe.Add(p, binder.offset)); err != nil {
+			errs = append(errs, ParamError{binder.in, binder.name, err.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		return NewProblem(http.StatusBadRequest, "the request parameters are invalid").With("code", "invalid_params").With("errors", errs)
+	}
+	return nil
+}
+
+//locate sets the source of the parameters violating their constraints.
+func (b *paramBinder) locate(violations Violations) {
+	for i := range violations {
+		violations[i].In = b.source(violations[i].Pointer)
+	}
+}
+
+//source returns the source of the parameter located by a JSON pointer.
+func (b *paramBinder) source(pointer string) string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(pointer, "/"), "/")
+	return b.sources[name]
+}
+
+//newFieldBinder returns the binder of a struct field, if tagged. Tags name the parameter, possibly followed by a default value,
+//as in query:"limit,default=20". The field name is used when the tag gives no name.
+func newFieldBinder(field reflect.StructField) (fieldBinder, bool, error) {
+	binder := fieldBinder{offset: field.Offset}
+	var tag string
+	for _, in := range paramSources {
+		if value, ok := field.Tag.Lookup(in); ok {
+			if binder.in != "" {
+				return binder, false, fmt.Errorf("bound to both %s and %s parameters", binder.in, in)
+			}
+			binder.in, tag = in, value
+		}
+	}
+	if binder.in == "" {
+		return binder, false, nil
+	}
+	if !field.IsExported() {
+		return binder, false, fmt.Errorf("unexported field cannot be bound")
+	}
+	name, options, _ := strings.Cut(tag, ",")
+	if binder.name = strings.TrimSpace(name); binder.name == "" {
+		binder.name = field.Name
+	}
+	if binder.in == "header" {
+		binder.name = http.CanonicalHeaderKey(binder.name)
+	}
+	if options != "" {
+		//the default value is the last option since it may contain commas, as in default=1,2
+		value, ok := strings.CutPrefix(options, "default=")
+		if !ok {
+			return binder, false, fmt.Errorf("unknown option %q", options)
+		}
+		binder.defaultValue = &value
+	}
+	var err error
+	if binder.convert, err = converterOf(field.Type); err != nil {
+		return binder, false, err
+	}
+	return binder, true, nil
+}
+
+//converterOf returns the converter of the values of a request parameter into the given type. Slices are set from repeated
+//values as well as comma-separated ones, pointers are allocated and types implementing encoding.TextUnmarshaler,
+//such as time.Time in RFC 3339 format, convert their values themselves.
+func converterOf(t reflect.Type) (converter, error) {
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		pointerType := typeWordOf(reflect.PointerTo(t))
+		return func(values []string, p unsafe.Pointer) error {
+			if err := interfaceAt(pointerType, p).(encoding.TextUnmarshaler).UnmarshalText([]byte(values[0])); err != nil {
+				return fmt.Errorf("%q is not a valid %v: %v", values[0], t, err)
+			}
+			return nil
+		}, nil
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		convert, err := converterOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		alloc := newOf(t.Elem())
+		return func(values []string, p unsafe.Pointer) error {
+			elem := alloc()
+			if err := convert(values, elem); err != nil {
+				return err
+			}
+			*(*unsafe.Pointer)(p) = elem
+			return nil
+		}, nil
+	case reflect.Slice:
+		convert, err := converterOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		makeSlice, size := makeSliceOf(t), t.Elem().Size()
+		return func(values []string, p unsafe.Pointer) error {
+			var elements []string
+			for _, value := range values {
+				for _, element := range strings.Split(value, ",") {
+					elements = append(elements, strings.TrimSpace(element))
+				}
+			}
+			data := makeSlice(p, len(elements))
+			for i, element := range elements {
+				if err := convert([]string{element}, unsafe.Add(data, uintptr(i)*size)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, nil
+	}
+	parse, err := parserOf(t)
+	if err != nil {
+		return nil, err
+	}
+	return func(values []string, p unsafe.Pointer) error {
+		if err := parse(values[0], p); err != nil {
+			return fmt.Errorf("%q is not a valid %v", values[0], t)
+		}
+		return nil
+	}, nil
+}
+
+//parserOf returns the function setting the value at p of a scalar type from its string representation.
+func parserOf(t reflect.Type) (func(s string, p unsafe.Pointer) error, error) {
+	if t == durationType {
+		return func(s string, p unsafe.Pointer) error {
+			d, err := time.ParseDuration(s)
+			*(*time.Duration)(p) = d
+			return err
+		}, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return func(s string, p unsafe.Pointer) error {
+			*(*string)(p) = s
+			return nil
+		}, nil
+	case reflect.Bool:
+		return func(s string, p unsafe.Pointer) error {
+			b, err := strconv.ParseBool(s)
+			*(*bool)(p) = b
+			return err
+		}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		store := storeOf(t.Size())
+		return func(s string, p unsafe.Pointer) error {
+			i, err := strconv.ParseInt(s, 10, t.Bits())
+			store(p, uint64(i))
+			return err
+		}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		store := storeOf(t.Size())
+		return func(s string, p unsafe.Pointer) error {
+			u, err := strconv.ParseUint(s, 10, t.Bits())
+			store(p, u)
+			return err
+		}, nil
+	case reflect.Float32:
+		return func(s string, p unsafe.Pointer) error {
+			f, err := strconv.ParseFloat(s, 32)
+			*(*float32)(p) = float32(f)
+			return err
+		}, nil
+	case reflect.Float64:
+		return func(s string, p unsafe.Pointer) error {
+			f, err := strconv.ParseFloat(s, 64)
+			*(*float64)(p) = f
+			return err
+		}, nil
+	}
+	return nil, fmt.Errorf("parameters cannot be converted to %v", t)
+}
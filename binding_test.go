@@ -0,0 +1,160 @@
+package pastis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return fmt.Errorf("unknown level")
+	}
+	return nil
+}
+
+type chartParams struct {
+	ID      int64         `path:"id"`
+	Limit   int           `query:"limit,default=20"`
+	Ratio   float64       `query:"ratio"`
+	Public  bool          `query:"public"`
+	Since   time.Time     `query:"since"`
+	Timeout time.Duration `query:"timeout,default=1s"`
+	Tags    []string      `query:"tag"`
+	Sizes   []uint8       `query:"sizes,default=1,2"`
+	Level   level         `query:"level"`
+	Page    *int          `query:"page"`
+	Tenant  string        `header:"x-tenant"`
+	Ignored string
+}
+
+func Test_Pastis_Param_Binding(t *testing.T) {
+	var bound chartParams
+	p := NewAPI()
+	p.Post("/charts/:id", func(params chartParams, input Foo) (Foo, error) {
+		bound = params
+		return input, nil
+	})
+	p.HandleFunc()
+
+	request := httptest.NewRequest("POST", "/charts/12?ratio=0.5&public=true&since=2020-01-02T03:04:05Z&tag=a&tag=b,c&level=high&page=3&Ignored=x", strings.NewReader(`{"Name":"chart","Order":1}`))
+	request.Header.Set("X-Tenant", "acme")
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, request)
+	assert_Foo_Response(t, rw.Result(), http.StatusOK, Foo{"chart", 1})
+	expect(t, bound.ID, int64(12))
+	expect(t, bound.Limit, 20)
+	expect(t, bound.Ratio, 0.5)
+	expect(t, bound.Public, true)
+	expect(t, bound.Since.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)), true)
+	expect(t, bound.Timeout, time.Second)
+	expect(t, strings.Join(bound.Tags, "|"), "a|b|c")
+	expect(t, fmt.Sprint(bound.Sizes), "[1 2]")
+	expect(t, bound.Level, level(2))
+	expect(t, *bound.Page, 3)
+	expect(t, bound.Tenant, "acme")
+	expect(t, bound.Ignored, "")
+
+	rw = callbackRequest(p, "POST", "/charts/12?limit=5&sizes=3", `{}`)
+	expect(t, rw.Code, http.StatusOK)
+	expect(t, bound.Limit, 5)
+	expect(t, fmt.Sprint(bound.Sizes), "[3]")
+	expect(t, bound.Page == nil, true)
+
+	rw = callbackRequest(p, "POST", "/charts/twelve?limit=-&public=maybe&sizes=1,300&level=medium&since=yesterday", `{}`)
+	var problem struct {
+		Status int
+		Code   string
+		Errors []ParamError
+	}
+	json.Unmarshal(rw.Body.Bytes(), &problem)
+	expect(t, rw.Code, http.StatusBadRequest)
+	expect(t, problem.Code, "invalid_params")
+	expect(t, len(problem.Errors), 6)
+	expect(t, problem.Errors[0], ParamError{"path", "id", `"twelve" is not a valid int64`})
+	expect(t, problem.Errors[1], ParamError{"query", "limit", `"-" is not a valid int`})
+	expect(t, problem.Errors[3].Name, "since")
+	expect(t, problem.Errors[4], ParamError{"query", "sizes", `"300" is not a valid uint8`})
+	expect(t, problem.Errors[5].Name, "level")
+}
+
+type layoutParams struct {
+	Small   int8        `query:"small"`
+	Medium  int16       `query:"medium"`
+	Count   uint32      `query:"count"`
+	Ratio   float32     `query:"ratio"`
+	Name    chartName   `query:"name"`
+	Since   *time.Time  `query:"since"`
+	Days    []time.Time `query:"day"`
+	Level   *level      `query:"level"`
+	Levels  []level     `query:"levels"`
+	Pages   []*int      `query:"page"`
+	Labels  *[]string   `query:"label"`
+	Checked bool        `query:"checked"`
+}
+
+type chartName string
+
+func Test_Pastis_Param_Binding_Layouts(t *testing.T) {
+	var bound layoutParams
+	p := NewAPI()
+	Handle(p, "GET", "/layouts", func(ctx context.Context, in layoutParams) (bool, error) {
+		bound = in
+		return true, nil
+	})
+	p.HandleFunc()
+
+	rw := callbackRequest(p, "GET", "/layouts?small=-3&medium=-300&count=70000&ratio=0.25&name=pie&since=2020-01-02T03:04:05Z"+
+		"&day=2020-01-02T00:00:00Z,2020-01-03T00:00:00Z&level=low&levels=high,low&page=1&page=2&label=x,y&checked=1", ``)
+	expect(t, rw.Code, http.StatusOK)
+	expect(t, bound.Small, int8(-3))
+	expect(t, bound.Medium, int16(-300))
+	expect(t, bound.Count, uint32(70000))
+	expect(t, bound.Ratio, float32(0.25))
+	expect(t, bound.Name, chartName("pie"))
+	expect(t, bound.Since.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)), true)
+	expect(t, len(bound.Days), 2)
+	expect(t, bound.Days[1].Equal(time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)), true)
+	expect(t, *bound.Level, level(1))
+	expect(t, fmt.Sprint(bound.Levels), "[2 1]")
+	expect(t, *bound.Pages[0]+*bound.Pages[1], 3)
+	expect(t, strings.Join(*bound.Labels, "|"), "x|y")
+	expect(t, bound.Checked, true)
+
+	rw = callbackRequest(p, "GET", "/layouts?small=200&page=2,x", ``)
+	expect(t, rw.Code, http.StatusBadRequest)
+	expect(t, strings.Contains(rw.Body.String(), `"name":"small"`), true)
+	expect(t, strings.Contains(rw.Body.String(), `"name":"page"`), true)
+}
+
+func Test_Pastis_Param_Binding_Errors(t *testing.T) {
+	p := NewAPI()
+	refute(t, p.Get("/channel", func(params struct {
+		Since chan int `query:"since"`
+	}) (int, interface{}) {
+		return http.StatusOK, nil
+	}), nil)
+	refute(t, p.Get("/sources", func(params struct {
+		Since string `query:"since" header:"since"`
+	}) (int, interface{}) {
+		return http.StatusOK, nil
+	}), nil)
+	refute(t, p.Get("/options", func(params struct {
+		Since string `query:"since,required"`
+	}) (int, interface{}) {
+		return http.StatusOK, nil
+	}), nil)
+	expect(t, len(p.Routes()), 0)
+}
@@ -0,0 +1,309 @@
+package pastis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+)
+
+// An HTTPError is an error returned by a callback that gives the status code of the response
+// and the message exposed to the client.
+type HTTPError interface {
+	error
+	StatusCode() int
+	PublicMessage() string
+}
+
+// An ErrorMapper returns the status code and the response content of an error returned by a callback
+// that does not implement HTTPError.
+type ErrorMapper func(err error) (int, interface{})
+
+//httpError is the HTTPError returned by NewHTTPError.
+type httpError struct {
+	code    int
+	message string
+}
+
+// NewHTTPError returns an HTTPError answered with the given status code and message.
+func NewHTTPError(code int, message string) error {
+	return &httpError{code, message}
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("%d %s", e.code, e.message)
+}
+
+func (e *httpError) StatusCode() int {
+	return e.code
+}
+
+func (e *httpError) PublicMessage() string {
+	return e.message
+}
+
+//Types of the callback arguments taken from the request being handled
+var (
+	contextType        = reflect.TypeOf((*context.Context)(nil)).Elem()
+	requestType        = reflect.TypeOf((*http.Request)(nil))
+	headerType         = reflect.TypeOf(http.Header{})
+	responseWriterType = reflect.TypeOf((*http.ResponseWriter)(nil)).Elem()
+	urlValuesType      = reflect.TypeOf(url.Values{})
+	errorType          = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+//callback is a function handling the requests of a route, along with the resolvers of its arguments and the handler of its results.
+type callback struct {
+	fn        reflect.Value
+	resolvers []argumentResolver
+	results   resultHandler
+	//call of the callback bypassing reflection, when its signature is a common one
+	direct directCall
+}
+
+//newCallback checks the signature of a callback function and builds how it is called, once, when the route is added,
+//so that handling a request only resolves the arguments and calls the function. The argument resolvers, parameter binders
+//and validators it relies on are built at the same time.
+func newCallback(fn reflect.Value) (*callback, error) {
+	if fn.Kind() != reflect.Func {
+		return nil, fmt.Errorf("callback should be a function, not %v", fn.Kind())
+	}
+	resolvers, err := argumentResolvers(fn.Type())
+	if err != nil {
+		return nil, err
+	}
+	results, err := resultHandlerOf(fn.Type())
+	if err != nil {
+		return nil, fmt.Errorf("unsupported callback %v: %v", fn.Type(), err)
+	}
+	return &callback{fn, resolvers, results, directCallOf(fn)}, nil
+}
+
+//A directCall calls a callback and converts its results without reflection.
+type directCall func(request *http.Request) (int, interface{}, error)
+
+//directCallOf returns the direct call of a callback whose signature is among the most common ones, nil otherwise.
+func directCallOf(fn reflect.Value) directCall {
+	if !fn.CanInterface() {
+		return nil
+	}
+	switch f := fn.Interface().(type) {
+	case func() (int, interface{}):
+		return func(request *http.Request) (int, interface{}, error) {
+			code, data := f()
+			return code, data, nil
+		}
+	case func(url.Values) (int, interface{}):
+		return func(request *http.Request) (int, interface{}, error) {
+			code, data := f(request.Form)
+			return code, data, nil
+		}
+	case func(*http.Request) (int, interface{}):
+		return func(request *http.Request) (int, interface{}, error) {
+			code, data := f(request)
+			return code, data, nil
+		}
+	case func() error:
+		return func(request *http.Request) (int, interface{}, error) {
+			if err := f(); err != nil {
+				return 0, nil, err
+			}
+			return http.StatusNoContent, nil, nil
+		}
+	}
+	return nil
+}
+
+//An argumentResolver returns a callback argument taken from the request being handled.
+type argumentResolver func(rw http.ResponseWriter, request *http.Request) (reflect.Value, error)
+
+//argumentResolvers returns the resolvers of the callback arguments, in order.
+//Arguments are injected according to their type, in any order: context.Context, *http.Request, http.Header, http.ResponseWriter
+//and url.Values (the URL query and path parameters) are taken from the request, parameter structs are bound to the request
+//parameters (see isParamStruct), while a single argument of any other type receives the unmarshalled JSON request body.
+func argumentResolvers(methodType reflect.Type) ([]argumentResolver, error) {
+	if methodType.IsVariadic() {
+		return nil, fmt.Errorf("variadic callback %v is not supported", methodType)
+	}
+	resolvers := make([]argumentResolver, methodType.NumIn())
+	var bodyType reflect.Type
+	for i := range resolvers {
+		switch argType := methodType.In(i); argType {
+		case contextType:
+			resolvers[i] = func(rw http.ResponseWriter, request *http.Request) (reflect.Value, error) {
+				return reflect.ValueOf(request.Context()), nil
+			}
+		case requestType:
+			resolvers[i] = func(rw http.ResponseWriter, request *http.Request) (reflect.Value, error) {
+				return reflect.ValueOf(request), nil
+			}
+		case headerType:
+			resolvers[i] = func(rw http.ResponseWriter, request *http.Request) (reflect.Value, error) {
+				return reflect.ValueOf(request.Header), nil
+			}
+		case responseWriterType:
+			resolvers[i] = func(rw http.ResponseWriter, request *http.Request) (reflect.Value, error) {
+				return reflect.ValueOf(&rw).Elem(), nil
+			}
+		case urlValuesType:
+			resolvers[i] = func(rw http.ResponseWriter, request *http.Request) (reflect.Value, error) {
+				return reflect.ValueOf(request.Form), nil
+			}
+		default:
+			if isParamStruct(argType) {
+				resolver, err := paramResolver(argType)
+				if err != nil {
+					return nil, err
+				}
+				resolvers[i] = resolver
+				continue
+			}
+			if bodyType != nil {
+				return nil, fmt.Errorf("callback %v has two request body arguments of type %v and %v", methodType, bodyType, argType)
+			}
+			bodyType = argType
+			resolver, err := bodyResolver(argType)
+			if err != nil {
+				return nil, err
+			}
+			resolvers[i] = resolver
+		}
+	}
+	return resolvers, nil
+}
+
+//errEmptyBody is returned along with the zero value of a required body argument when the request has no body.
+var errEmptyBody = errors.New("the request body is required")
+
+//bodiless reports whether the requests of the given method come without body, such as the CORS preflight requests routed
+//to the route of the method they announce, so that the empty body problem is never answered to them.
+func bodiless(method string) bool {
+	return method == "OPTIONS" || method == "HEAD"
+}
+
+//bodyResolver returns the resolver of the callback argument receiving the JSON request body.
+//A body argument is required unless it is a pointer, which is nil when the request has no body.
+//The decoded body is then validated (see newValidator), the resolver failing with its Violations.
+func bodyResolver(bodyType reflect.Type) (argumentResolver, error) {
+	validator, err := newValidator(bodyType)
+	if err != nil {
+		return nil, err
+	}
+	optional := bodyType.Kind() == reflect.Ptr
+	return func(rw http.ResponseWriter, request *http.Request) (reflect.Value, error) {
+		body := reflect.New(bodyType)
+		if err := decodeBody(request, body.Interface(), optional); err == errEmptyBody {
+			return body.Elem(), err
+		} else if err != nil {
+			return reflect.Value{}, err
+		}
+		if validator != nil {
+			var violations Violations
+			validator(body.UnsafePointer(), "", &violations)
+			if len(violations) > 0 {
+				for i := range violations {
+					violations[i].In = "body"
+				}
+				return body.Elem(), violations
+			}
+		}
+		return body.Elem(), nil
+	}, nil
+}
+
+//decodeBody decodes the JSON request body into the value pointed to by target.
+//It returns errEmptyBody when the request has no body, unless the body is optional.
+func decodeBody(request *http.Request, target interface{}, optional bool) error {
+	dec := json.NewDecoder(request.Body)
+	for decoded := false; ; decoded = true {
+		if err := dec.Decode(target); err == io.EOF {
+			if !decoded && !optional {
+				return errEmptyBody
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+//argumentProblem returns the problem answered when a callback argument cannot be resolved.
+//When the request body cannot be decoded, it tells the offending field, the expected type and the offset of the error in the body
+//when they are known.
+func argumentProblem(err error) *Problem {
+	var problem *Problem
+	if errors.As(err, &problem) {
+		return problem
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return NewProblem(http.StatusBadRequest, fmt.Sprintf("the request body is malformed at offset %d: %v", syntaxErr.Offset, syntaxErr)).
+			With("code", "malformed_body").With("offset", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		problem := NewProblem(http.StatusBadRequest, fmt.Sprintf("the request body has a %s where a %v is expected at offset %d", typeErr.Value, typeErr.Type, typeErr.Offset)).
+			With("code", "invalid_body").With("expected", typeErr.Type.String()).With("offset", typeErr.Offset)
+		if typeErr.Field != "" {
+			problem.Detail = fmt.Sprintf("the field %s of the request body has a %s where a %v is expected at offset %d", typeErr.Field, typeErr.Value, typeErr.Type, typeErr.Offset)
+			problem.With("field", typeErr.Field)
+		}
+		return problem
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return NewProblem(http.StatusBadRequest, "the request body is truncated").With("code", "malformed_body")
+	}
+	return NewProblem(http.StatusBadRequest, fmt.Sprintf("the request body cannot be decoded: %v", err)).With("code", "invalid_body")
+}
+
+//A resultHandler converts the results of a callback into the status code and the content of the response,
+//or the error returned by the callback.
+type resultHandler func(results []reflect.Value) (int, interface{}, error)
+
+//resultHandlerOf returns the handler of the callback results.
+//The supported results are (int, T), (T, error), (int, T, error) and error alone. Without status code, the response is
+//200 OK, or 204 No Content when the callback only returns an error.
+func resultHandlerOf(methodType reflect.Type) (resultHandler, error) {
+	numOut := methodType.NumOut()
+	returnsError := numOut > 0 && methodType.Out(numOut-1) == errorType
+	returnsCode := numOut > 1 && methodType.Out(0).Kind() == reflect.Int
+	switch {
+	case numOut == 1 && returnsError:
+		return func(results []reflect.Value) (int, interface{}, error) {
+			if err := resultError(results[0]); err != nil {
+				return 0, nil, err
+			}
+			return http.StatusNoContent, nil, nil
+		}, nil
+	case numOut == 2 && returnsError:
+		return func(results []reflect.Value) (int, interface{}, error) {
+			if err := resultError(results[1]); err != nil {
+				return 0, nil, err
+			}
+			return http.StatusOK, results[0].Interface(), nil
+		}, nil
+	case numOut == 2 && returnsCode:
+		return func(results []reflect.Value) (int, interface{}, error) {
+			return int(results[0].Int()), results[1].Interface(), nil
+		}, nil
+	case numOut == 3 && returnsCode && returnsError:
+		return func(results []reflect.Value) (int, interface{}, error) {
+			if err := resultError(results[2]); err != nil {
+				return 0, nil, err
+			}
+			return int(results[0].Int()), results[1].Interface(), nil
+		}, nil
+	}
+	return nil, errors.New("callback should return (int, T), (T, error), (int, T, error) or error")
+}
+
+//resultError returns the error held by a callback result, if any.
+func resultError(result reflect.Value) error {
+	if result.IsNil() {
+		return nil
+	}
+	return result.Interface().(error)
+}
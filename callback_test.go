@@ -0,0 +1,364 @@
+package pastis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var errQuota = errors.New("quota exceeded")
+
+func callbackRequest(p *API, method string, path string, body string) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rw
+}
+
+func Test_Pastis_Callback_Results(t *testing.T) {
+	p := NewAPI()
+	p.Get("/value", func() (Foo, error) {
+		return Foo{"value", 1}, nil
+	})
+	p.Post("/created", func(input Foo) (int, Foo, error) {
+		return http.StatusCreated, input, nil
+	})
+	p.Delete(func() error {
+		return nil
+	}, "/deleted")
+	p.Get("/missing", func() (Foo, error) {
+		return Foo{}, NewHTTPError(http.StatusNotFound, "no such foo")
+	})
+	p.Get("/wrapped", func() (int, Foo, error) {
+		return http.StatusOK, Foo{}, fmt.Errorf("loading foo: %w", NewHTTPError(http.StatusConflict, "foo is locked"))
+	})
+	p.Get("/failed", func() error {
+		return errors.New("database password is wrong")
+	})
+	p.HandleFunc()
+
+	assert_Foo_Response(t, callbackRequest(p, "GET", "/value", "").Result(), http.StatusOK, Foo{"value", 1})
+	assert_Foo_Response(t, callbackRequest(p, "POST", "/created", `{"Name":"created","Order":2}`).Result(), http.StatusCreated, Foo{"created", 2})
+
+	rw := callbackRequest(p, "DELETE", "/deleted", "")
+	expect(t, rw.Code, http.StatusNoContent)
+	expect(t, rw.Body.Len(), 0)
+
+	var problem Problem
+	rw = callbackRequest(p, "GET", "/missing", "")
+	expect(t, rw.Code, http.StatusNotFound)
+	json.Unmarshal(rw.Body.Bytes(), &problem)
+	expect(t, problem.Detail, "no such foo")
+
+	rw = callbackRequest(p, "GET", "/wrapped", "")
+	expect(t, rw.Code, http.StatusConflict)
+	json.Unmarshal(rw.Body.Bytes(), &problem)
+	expect(t, problem.Detail, "foo is locked")
+
+	rw = callbackRequest(p, "GET", "/failed", "")
+	expect(t, rw.Code, http.StatusInternalServerError)
+	expect(t, strings.Contains(rw.Body.String(), "password"), false)
+}
+
+func Test_Pastis_Error_Mapper(t *testing.T) {
+	p := NewAPI()
+	p.SetErrorMapper(func(err error) (int, interface{}) {
+		if errors.Is(err, errQuota) {
+			return http.StatusTooManyRequests, ErrorResponse(err)
+		}
+		return http.StatusServiceUnavailable, ErrorResponse(errors.New("try again later"))
+	})
+	p.Get("/quota", func() (Foo, error) {
+		return Foo{}, fmt.Errorf("user 12: %w", errQuota)
+	})
+	p.Get("/other", func() error {
+		return errors.New("connection reset")
+	})
+	p.Get("/http", func() error {
+		return NewHTTPError(http.StatusForbidden, "forbidden")
+	})
+	p.HandleFunc()
+
+	var body map[string]string
+	rw := callbackRequest(p, "GET", "/quota", "")
+	expect(t, rw.Code, http.StatusTooManyRequests)
+	json.Unmarshal(rw.Body.Bytes(), &body)
+	expect(t, body["error"], "user 12: quota exceeded")
+	rw = callbackRequest(p, "GET", "/other", "")
+	expect(t, rw.Code, http.StatusServiceUnavailable)
+	json.Unmarshal(rw.Body.Bytes(), &body)
+	expect(t, body["error"], "try again later")
+	assert_Error_Response(t, callbackRequest(p, "GET", "/http", "").Result(), http.StatusForbidden)
+}
+
+type Order struct {
+	Items []Foo
+	Notes map[string]Foo
+}
+
+func Test_Pastis_Body_Decoding_Errors(t *testing.T) {
+	p := NewAPI()
+	p.Post("/orders", func(order Order) (Order, error) {
+		return order, nil
+	})
+	p.Post("/optional", func(order *Order) (Foo, error) {
+		if order == nil {
+			return Foo{"none", 0}, nil
+		}
+		return Foo{"order", len(order.Items)}, nil
+	})
+	p.HandleFunc()
+
+	problem := func(rw *httptest.ResponseRecorder) Problem {
+		var problem Problem
+		assert_Error_Response(t, rw.Result(), http.StatusBadRequest)
+		json.Unmarshal(rw.Body.Bytes(), &problem)
+		return problem
+	}
+
+	pb := problem(callbackRequest(p, "POST", "/orders", `{"Items":[{"Name":"a","Order":1},{"Name":"b","Order":"2"}]}`))
+	expect(t, pb.Extensions["code"], "invalid_body")
+	expect(t, pb.Extensions["field"], "Items.1.Order")
+	expect(t, pb.Extensions["expected"], "int")
+	expect(t, pb.Extensions["offset"], float64(56))
+	expect(t, pb.Instance, "/orders")
+
+	pb = problem(callbackRequest(p, "POST", "/orders", `{"Notes":{"first":{"Name":true}}}`))
+	expect(t, pb.Extensions["field"], "Notes.first.Name")
+	expect(t, pb.Extensions["expected"], "string")
+
+	pb = problem(callbackRequest(p, "POST", "/orders", `{"Items":[}`))
+	expect(t, pb.Extensions["code"], "malformed_body")
+	expect(t, pb.Extensions["offset"], float64(11))
+
+	pb = problem(callbackRequest(p, "POST", "/orders", `{"Items":[`))
+	expect(t, pb.Extensions["code"], "malformed_body")
+
+	pb = problem(callbackRequest(p, "POST", "/orders", ""))
+	expect(t, pb.Extensions["code"], "empty_body")
+
+	//a CORS preflight request is routed to the POST route without body, even when no CORS filter answers it
+	preflight := httptest.NewRequest("OPTIONS", "/orders", nil)
+	preflight.Header.Set("Origin", "http://example.com")
+	preflight.Header.Set(HEADER_Access_Control_Request_Method, "POST")
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, preflight)
+	expect(t, rw.Code, http.StatusOK)
+	expect(t, rw.Body.String(), `{"Items":null,"Notes":null}`)
+
+	assert_Foo_Response(t, callbackRequest(p, "POST", "/optional", "").Result(), http.StatusOK, Foo{"none", 0})
+	assert_Foo_Response(t, callbackRequest(p, "POST", "/optional", `{"Items":[{}, {}]}`).Result(), http.StatusOK, Foo{"order", 2})
+
+	p.SetEmptyBodyProblem(NewProblem(http.StatusUnprocessableEntity, "an order is expected"))
+	rw = callbackRequest(p, "POST", "/orders", "")
+	expect(t, rw.Code, http.StatusUnprocessableEntity)
+	expect(t, strings.Contains(rw.Body.String(), "an order is expected"), true)
+
+	p.SetEmptyBodyProblem(nil)
+	expect(t, callbackRequest(p, "POST", "/orders", "").Code, http.StatusOK)
+}
+
+type brokenResource struct{}
+
+func (brokenResource) Get() string {
+	return "broken"
+}
+
+func (brokenResource) Post(input Foo) (int, interface{}) {
+	return http.StatusCreated, input
+}
+
+type pairResource struct{}
+
+func (pairResource) Get() (Foo, error) {
+	return Foo{}, nil
+}
+
+func (pairResource) Post(input Foo) (Foo, error) {
+	return input, nil
+}
+
+func Test_Pastis_Callback_Signatures(t *testing.T) {
+	p := NewAPI()
+	err := p.Get("/string", "not a function")
+	expect(t, err.Error(), "GET /string: callback should be a function, not string")
+	err = p.Get("/results", func() (Foo, int) {
+		return Foo{}, 0
+	})
+	expect(t, err.Error(), "GET /results: unsupported callback func() (pastis.Foo, int): callback should return (int, T), (T, error), (int, T, error) or error")
+	refute(t, p.Get("/variadic", func(values ...string) error {
+		return nil
+	}), nil)
+	err = p.AddResource("/broken", brokenResource{})
+	expect(t, err.Error(), "GET /broken: unsupported callback func() string: callback should return (int, T), (T, error), (int, T, error) or error")
+
+	//a resource is added as a whole or not at all
+	expect(t, len(p.Routes()), 0)
+	expect(t, p.Post("/foos", func(input Foo) (int, interface{}) {
+		return http.StatusCreated, input
+	}), nil)
+	refute(t, p.AddResource("/foos", pairResource{}), nil)
+	routes := p.Routes()
+	expect(t, len(routes), 1)
+	expect(t, routes[0].Method, "POST")
+}
+
+func Test_Pastis_Callback_Direct_Calls(t *testing.T) {
+	for _, fn := range []interface{}{
+		func() (int, interface{}) { return http.StatusOK, nil },
+		func(url.Values) (int, interface{}) { return http.StatusOK, nil },
+		func(*http.Request) (int, interface{}) { return http.StatusOK, nil },
+		func() error { return nil },
+		new(FooResource).Get,
+	} {
+		cb, err := newCallback(reflect.ValueOf(fn))
+		expect(t, err, nil)
+		refute(t, cb.direct, nil)
+	}
+	cb, _ := newCallback(reflect.ValueOf(func(Foo) (int, interface{}) { return http.StatusOK, nil }))
+	expect(t, cb.direct == nil, true)
+}
+
+//baselineHandleMethodCall is a copy of the handleMethodCall function of the first pastis release, which analysed the callback
+//through reflection on every request. It is kept to compare the precompiled callbacks with it.
+func baselineHandleMethodCall(api *API, urlValues url.Values, request *http.Request, methodRef reflect.Value) (int, interface{}) {
+	api.logger.Debugf("handleMethodCall %s", request.Method)
+
+	if methodRef.Kind() == reflect.Invalid {
+		return http.StatusNotImplemented, nil
+	}
+
+	methodType := methodRef.Type()
+	methodArgSize := methodRef.Type().NumIn()
+
+	api.logger.Debugf("method has %d argument.", methodArgSize)
+
+	if methodArgSize >= 3 {
+		api.logger.Errorf("method %v cannot have more than 2 arguments", methodRef)
+		return http.StatusNotImplemented, nil
+	}
+
+	if methodArgSize == 0 {
+		api.logger.Errorf("method %v has no argument. Skip marshalling...", methodRef)
+		return baselineHandleReturn(api, methodRef, []reflect.Value{})
+	}
+
+	valueOfUrlValues := reflect.ValueOf(urlValues)
+	methodParameterValues := []reflect.Value{valueOfUrlValues}
+
+	expectedJSONType := methodType.In(0)
+
+	if methodArgSize == 1 {
+		if expectedJSONType == valueOfUrlValues.Type() {
+			api.logger.Debugf(" method has one argument of type url.Values. Skip marshalling...")
+			return baselineHandleReturn(api, methodRef, methodParameterValues)
+		} else {
+			api.logger.Debugf(" method %v has one argument of request body type. ", methodRef)
+			methodParameterValues = []reflect.Value{} // will add later the json body as parameter
+		}
+	} else if methodArgSize == 2 {
+		api.logger.Debug(" method first argument is not the request body type.\n")
+		expectedJSONType = methodType.In(1)
+		api.logger.Debugf(" method second argument is the request body type %v.\n", expectedJSONType)
+	}
+
+	expectedJSONValue := reflect.New(expectedJSONType)
+
+	jsonInterface := expectedJSONValue.Interface()
+
+	dec := json.NewDecoder(request.Body)
+	for {
+		if err := dec.Decode(jsonInterface); err == io.EOF {
+			break
+		} else if err != nil {
+			api.logger.Error(" unable to decode json blob. Check whether parameter type matches json type. \n")
+			return http.StatusNotImplemented, nil
+		}
+	}
+
+	jsonValue := reflect.ValueOf(jsonInterface)
+	jsonValueType := jsonValue.Elem().Type()
+
+	if expectedJSONType.Kind() != jsonValue.Elem().Type().Kind() {
+		api.logger.Errorf(" Unexpected JSON format. Should be of type '%v' instead of %v", expectedJSONType.Kind(), jsonValueType.Kind())
+		return http.StatusNotImplemented, nil
+	} else if expectedJSONType != jsonValue.Type() {
+		methodParameterValues = append(methodParameterValues, jsonValue.Elem())
+	} else {
+		api.logger.Errorf(" Parameter type mismatches json type. Expected JSON format %v.", expectedJSONType)
+		return http.StatusNotImplemented, nil
+	}
+	return baselineHandleReturn(api, methodRef, methodParameterValues)
+}
+
+//baselineHandleReturn is a copy of the handleReturn function of the first pastis release.
+func baselineHandleReturn(api *API, methodRef reflect.Value, methodParameterValues []reflect.Value) (int, interface{}) {
+	responseValues := methodRef.Call(methodParameterValues)
+	if len(responseValues) != 2 {
+		api.logger.Errorf(" method %v does not return expected response (int, interface{}).", methodRef)
+		return http.StatusNotImplemented, nil
+	}
+	return int(responseValues[0].Int()), responseValues[1].Interface()
+}
+
+//benchmarkCallback measures the handling of a request by a callback, either through the baseline reflection code
+//or through the callback precompiled when its route is added.
+func benchmarkCallback(b *testing.B, fn interface{}, body string, baseline bool) {
+	p := NewAPI()
+	p.logger.SetLevel("ERROR")
+	request := httptest.NewRequest("POST", "/charts?id=12", nil)
+	request.ParseForm()
+	reader := strings.NewReader(body)
+	request.Body = io.NopCloser(reader)
+	rw := httptest.NewRecorder()
+	methodRef := reflect.ValueOf(fn)
+	cb, err := newCallback(methodRef)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reader.Reset(body)
+		var code int
+		if baseline {
+			code, _ = baselineHandleMethodCall(p, request.Form, request, methodRef)
+		} else {
+			code, _ = p.handleMethodCall(rw, request, cb)
+		}
+		if code != http.StatusOK {
+			b.Fatalf("unexpected status %d", code)
+		}
+	}
+}
+
+//paramsCallback and bodyCallback have signatures supported by the baseline code.
+func paramsCallback(params url.Values) (int, interface{}) {
+	return http.StatusOK, params.Get("id")
+}
+
+func bodyCallback(params url.Values, input Foo) (int, interface{}) {
+	return http.StatusOK, input
+}
+
+func Benchmark_Callback_Params_Baseline(b *testing.B) {
+	benchmarkCallback(b, paramsCallback, "", true)
+}
+
+func Benchmark_Callback_Params_Precompiled(b *testing.B) {
+	benchmarkCallback(b, paramsCallback, "", false)
+}
+
+func Benchmark_Callback_Body_Baseline(b *testing.B) {
+	benchmarkCallback(b, bodyCallback, `{"Name":"chart","Order":1}`, true)
+}
+
+func Benchmark_Callback_Body_Precompiled(b *testing.B) {
+	benchmarkCallback(b, bodyCallback, `{"Name":"chart","Order":1}`, false)
+}
@@ -0,0 +1,115 @@
+package pastis
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//constraint restricts the values a path parameter accepts.
+//It is declared in a pattern after the parameter name, either by name (/charts/:id<int>)
+//or as a regular expression (/files/:slug<[a-z0-9-]+>). A bare identifier is always taken as a name,
+//so that a misspelt name is reported instead of being matched literally.
+type constraint struct {
+	//expression as written in the pattern
+	name string
+	//regular expression matched by the whole parameter value
+	expr   string
+	regexp *regexp.Regexp
+}
+
+//Built-in constraints available to every router.
+var defaultConstraints = map[string]string{
+	"int":   `-?[0-9]+`,
+	"uint":  `[0-9]+`,
+	"alpha": `[a-zA-Z]+`,
+	"alnum": `[a-zA-Z0-9]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
+//constraintParam matches path parameters declaring a constraint in a pattern.
+var constraintParam = regexp.MustCompile(`:([^/#?()\.\\<>]+)<([^>]+)>`)
+
+//constraintName matches the declarations naming a constraint rather than giving its regular expression.
+var constraintName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+//equal reports whether both constraints accept the same values.
+func (c *constraint) equal(other *constraint) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+	return c.expr == other.expr
+}
+
+//newConstraint compiles a constraint matching the given regular expression.
+func newConstraint(name string, expr string) (*constraint, error) {
+	r, err := regexp.Compile(`^(?:` + expr + `)$`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid constraint <%s>: %v", name, err)
+	}
+	return &constraint{name: name, expr: expr, regexp: r}, nil
+}
+
+// AddConstraint registers a named constraint that path parameters may declare as :param<name>.
+// A parameter value satisfies the constraint when it fully matches the regular expression expr.
+// Constraints must be added before the routes using them.
+func (router *Router) AddConstraint(name string, expr string) error {
+	c, err := newConstraint(name, expr)
+	if err != nil {
+		return err
+	}
+	return router.update(func(rt *routing) error {
+		constraints := make(map[string]*constraint, len(rt.constraints)+1)
+		for n, existing := range rt.constraints {
+			constraints[n] = existing
+		}
+		constraints[name] = c
+		rt.constraints = constraints
+		return nil
+	})
+}
+
+//constraint returns the constraint referred to by the given name or regular expression.
+//It returns an error when the name of the constraint is unknown or its regular expression is invalid.
+func (rt *routing) constraint(name string) (*constraint, error) {
+	if c := rt.constraints[name]; c != nil {
+		return c, nil
+	}
+	if constraintName.MatchString(name) {
+		return nil, fmt.Errorf("unknown constraint <%s>", name)
+	}
+	return newConstraint(name, name)
+}
+
+//checkConstraints returns an error when a constrained parameter of the pattern refers to an unknown constraint
+//or to an invalid regular expression.
+func (rt *routing) checkConstraints(pattern string) error {
+	for _, groups := range constraintParam.FindAllStringSubmatch(pattern, -1) {
+		if _, err := rt.constraint(groups[2]); err != nil {
+			return fmt.Errorf("invalid parameter %s of pattern %s: %v", groups[1], pattern, err)
+		}
+	}
+	return nil
+}
+
+//compilePattern compiles a regular expression pattern as Regexp does, its constrained parameters becoming named groups
+//matching their constraint. The constraint expressions are inserted as they are, the other parameters being expanded around them.
+func (rt *routing) compilePattern(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	var catchAlls, last int
+	for _, loc := range constraintParam.FindAllStringSubmatchIndex(pattern, -1) {
+		c, err := rt.constraint(pattern[loc[4]:loc[5]])
+		if err != nil {
+			return nil, err
+		}
+		expr.WriteString(expandParams(pattern[last:loc[0]], &catchAlls))
+		fmt.Fprintf(&expr, `(?P<%s>%s)`, pattern[loc[2]:loc[3]], c.expr)
+		last = loc[1]
+	}
+	expr.WriteString(expandParams(pattern[last:], &catchAlls))
+	r, err := regexp.Compile(expr.String() + `\/?`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %v", pattern, err)
+	}
+	return r, nil
+}
@@ -28,15 +28,17 @@ func (f *FilterChain) NextFilter(rw http.ResponseWriter, request *http.Request)
 	}
 }
 
-// Return the request handler calling the filter after passing through its own filters
+// Return the request handler calling the filter after passing through its own filters.
+// Each request goes through its own copy of the chain so that concurrent requests do not share the chain index.
 func (f *FilterChain) dispatchRequestHandler() http.HandlerFunc {
 	return func(rw http.ResponseWriter, request *http.Request) {
-		f.Index = 0
-		if len(f.Filters) > 0 {
-			f.NextFilter(rw, request)
+		chain := f.Copy()
+		chain.Index = 0
+		if len(chain.Filters) > 0 {
+			chain.NextFilter(rw, request)
 		} else {
 			// unfiltered
-			f.Target(rw, request)
+			chain.Target(rw, request)
 		}
 	}
 }
@@ -0,0 +1,173 @@
+package pastis
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"unsafe"
+)
+
+// Handle adds a route whose typed callback receives the request context and an input of type In, and returns an output of type Out
+// answered as JSON with 200 OK, or an error mapped as the errors returned by the other callbacks (see SetErrorMapper).
+//
+// The input bundles the request body and parameters: its fields tagged path, query or header are bound to the request parameters
+// as the fields of parameter structs are, while its field tagged body receives the JSON request body. An input having no such field
+// is the request body itself, except for a struct having no field at all (such as struct{}), which leaves the request body unread.
+// The input is then validated according to its validate tags and Validate method. Since GET and HEAD requests have no body,
+// their routes are rejected when their input reads the request body.
+//
+//	type ChartInput struct {
+//		ID    int64 `path:"id"`
+//		Chart Chart `body:""`
+//	}
+//
+//	pastis.Handle(api, "PUT", "/charts/:id", func(ctx context.Context, in ChartInput) (Chart, error) {
+//		...
+//	})
+//
+// Unlike the callbacks of Do and the route functions, the callback is type-checked at compile time and called without reflection.
+// Its input is bound and validated by setters and validators generated when the route is added, which access the input fields
+// through their offset rather than through reflection. Only the allocation of pointer and slice parameters whose elements hold pointers,
+// other than strings and time.Time, and the dive rule over maps still go through reflection.
+// Both kinds of callbacks may be added to the same API.
+func Handle[In, Out any](api *API, requestMethod string, pattern string, fn func(ctx context.Context, in In) (Out, error), options ...RouteOption) error {
+	return handle(api, requestMethod, pattern, fn, nil, options)
+}
+
+// HandleGroup adds a typed route below the group prefix, after the API and group filters (see Handle).
+func HandleGroup[In, Out any](g *Group, requestMethod string, pattern string, fn func(ctx context.Context, in In) (Out, error), options ...RouteOption) error {
+	return handle(g.api, requestMethod, joinPattern(g.prefix, pattern), fn, g.filters, g.routeOptions(options))
+}
+
+//handle adds a typed route filtered by the given filters after the API ones.
+func handle[In, Out any](api *API, requestMethod string, pattern string, fn func(ctx context.Context, in In) (Out, error), filters []Filter, options []RouteOption) error {
+	inType := reflect.TypeOf((*In)(nil)).Elem()
+	binder, err := newInputBinder(inType)
+	if err == nil && (binder.wholeBody || binder.body) && (requestMethod == "GET" || requestMethod == "HEAD") {
+		err = fmt.Errorf("input %v reads the request body, which %s requests do not have", inType, requestMethod)
+	}
+	if err != nil {
+		return api.rejectRoute(fmt.Errorf("%s %s: %v", requestMethod, pattern, err))
+	}
+	handler := func(rw http.ResponseWriter, request *http.Request) {
+		var in In
+		if err := binder.bind(request, unsafe.Pointer(&in), api.emptyBody != nil && !bodiless(request.Method)); err != nil {
+			code, data := api.argumentError(request, err)
+			api.handlerFuncReturn(code, data, rw)
+			return
+		}
+		out, err := fn(request.Context(), in)
+		code, data := api.handleReturn(http.StatusOK, out, err)
+		api.handlerFuncReturn(code, data, rw)
+	}
+	if err := api.addHandler(requestMethod, handler, funcName(fn), pattern, filters, options); err != nil {
+		return err
+	}
+	api.logger.Debugf(" Added Handle [method={%v},pattern={%v}]", requestMethod, pattern)
+	return nil
+}
+
+//inputBinder fills the input of a typed callback from the request body and parameters.
+type inputBinder struct {
+	//whether the input is the request body itself
+	wholeBody bool
+	//binder of the input fields tagged path, query or header, nil for a struct having no field
+	params *paramBinder
+	//type word of the pointers to the input (see interfaceAt)
+	pointerType unsafe.Pointer
+	//whether a field receives the request body, along with its offset, the type word of the pointers to it
+	//and its JSON pointer reference token
+	body            bool
+	bodyOffset      uintptr
+	bodyPointerType unsafe.Pointer
+	bodyName        string
+	//whether the request body may be empty, when it is decoded into a pointer
+	optional  bool
+	validator valueValidator
+}
+
+//newInputBinder returns the binder of the input type of a typed callback.
+func newInputBinder(inType reflect.Type) (*inputBinder, error) {
+	validator, err := newValidator(inType)
+	if err != nil {
+		return nil, err
+	}
+	b := &inputBinder{validator: validator, pointerType: typeWordOf(reflect.PointerTo(inType))}
+	if inType.Kind() == reflect.Struct && inType.NumField() == 0 {
+		//nothing to bind: the request body is not expected, even for a GET request
+		return b, nil
+	}
+	var bodyField *reflect.StructField
+	if inType.Kind() == reflect.Struct {
+		for i := 0; i < inType.NumField(); i++ {
+			field := inType.Field(i)
+			if _, ok := field.Tag.Lookup("body"); !ok {
+				continue
+			}
+			if bodyField != nil {
+				return nil, fmt.Errorf("input %v has two body fields %s and %s", inType, bodyField.Name, field.Name)
+			}
+			for _, in := range paramSources {
+				if _, ok := field.Tag.Lookup(in); ok {
+					return nil, fmt.Errorf("field %s of %v is bound to both the body and a %s parameter", field.Name, inType, in)
+				}
+			}
+			bodyField = &field
+		}
+	}
+	if bodyField == nil && !isParamStruct(inType) {
+		b.wholeBody = true
+		b.optional = inType.Kind() == reflect.Ptr
+		return b, nil
+	}
+	if b.params, err = newParamBinder(inType); err != nil {
+		return nil, err
+	}
+	if bodyField != nil {
+		b.body, b.bodyOffset, b.bodyName = true, bodyField.Offset, escapePointer(fieldName(*bodyField))
+		b.bodyPointerType = typeWordOf(reflect.PointerTo(bodyField.Type))
+		b.optional = bodyField.Type.Kind() == reflect.Ptr
+	}
+	return b, nil
+}
+
+//bind fills the input at p from the request, then validates it. It fails with the same errors as the argument resolvers
+//of the other callbacks, errEmptyBody being returned for an empty request body only when a body is required.
+func (b *inputBinder) bind(request *http.Request, p unsafe.Pointer, requireBody bool) error {
+	optional := b.optional || !requireBody
+	if b.wholeBody {
+		if err := decodeBody(request, interfaceAt(b.pointerType, p), optional); err != nil {
+			return err
+		}
+	} else if b.params != nil {
+		if err := b.params.bind(request, p); err != nil {
+			return err
+		}
+		if b.body {
+			if err := decodeBody(request, interfaceAt(b.bodyPointerType, unsafe.Add(p, b.bodyOffset)), optional); err != nil {
+				return err
+			}
+		}
+	}
+	if b.validator == nil {
+		return nil
+	}
+	var violations Violations
+	b.validator(p, "", &violations)
+	if len(violations) == 0 {
+		return nil
+	}
+	for i := range violations {
+		if b.wholeBody {
+			violations[i].In = "body"
+		} else if rest, ok := strings.CutPrefix(violations[i].Pointer, "/"+b.bodyName); ok && b.body && (rest == "" || rest[0] == '/') {
+			//the violations of the body are located relatively to the body
+			violations[i].In, violations[i].Pointer = "body", rest
+		} else {
+			violations[i].In = b.params.source(violations[i].Pointer)
+		}
+	}
+	return violations
+}
@@ -0,0 +1,196 @@
+package pastis
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type chartInput struct {
+	ID     int64  `path:"id" validate:"min=1"`
+	Limit  int    `query:"limit,default=20"`
+	Tenant string `header:"X-Tenant" validate:"required"`
+	Chart  Foo    `body:""`
+}
+
+type chartOutput struct {
+	ID     int64
+	Limit  int
+	Tenant string
+	Name   string
+	User   string
+}
+
+type namedFoo struct {
+	Name  string `validate:"required"`
+	Order int
+}
+
+func Test_Pastis_Handle(t *testing.T) {
+	p := NewAPI()
+	p.AddFilter(func(rw http.ResponseWriter, request *http.Request, chain *FilterChain) {
+		chain.NextFilter(rw, request.WithContext(context.WithValue(request.Context(), contextKey("user"), "alice")))
+	})
+	expect(t, Handle(p, "PUT", "/charts/:id", func(ctx context.Context, in chartInput) (chartOutput, error) {
+		return chartOutput{in.ID, in.Limit, in.Tenant, in.Chart.Name, ctx.Value(contextKey("user")).(string)}, nil
+	}), nil)
+	expect(t, Handle(p, "POST", "/foos", func(ctx context.Context, in namedFoo) (Foo, error) {
+		if in.Name == "taken" {
+			return Foo{}, NewHTTPError(http.StatusConflict, "name is taken")
+		}
+		return Foo{in.Name, in.Order + 1}, nil
+	}), nil)
+	expect(t, Handle(p, "POST", "/optional", func(ctx context.Context, in *Foo) (bool, error) {
+		return in == nil, nil
+	}), nil)
+	expect(t, Handle(p, "POST", "/counts", func(ctx context.Context, in int) (int, error) {
+		return in, nil
+	}), nil)
+	expect(t, Handle(p, "GET", "/foos", func(ctx context.Context, in struct{}) ([]Foo, error) {
+		return []Foo{{"foo", 1}}, nil
+	}), nil)
+	expect(t, p.Get("/foos/:name", func(params url.Values) (int, interface{}) {
+		return http.StatusOK, Foo{params.Get("name"), 1}
+	}), nil)
+	p.HandleFunc()
+
+	request := httptest.NewRequest("PUT", "/charts/12?limit=5", strings.NewReader(`{"Name":"chart","Order":1}`))
+	request.Header.Set("X-Tenant", "acme")
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, request)
+	expect(t, rw.Code, http.StatusOK)
+	expect(t, rw.Header().Get("Content-Type"), "application/json")
+	var out chartOutput
+	json.Unmarshal(rw.Body.Bytes(), &out)
+	expect(t, out, chartOutput{12, 5, "acme", "chart", "alice"})
+
+	rw = callbackRequest(p, "PUT", "/charts/0", `{"Name":"chart"}`)
+	var problem struct {
+		Violations Violations
+	}
+	json.Unmarshal(rw.Body.Bytes(), &problem)
+	expect(t, rw.Code, http.StatusUnprocessableEntity)
+	expect(t, len(problem.Violations), 2)
+	expect(t, problem.Violations[0], Violation{"path", "/id", "must be at least 1"})
+	expect(t, problem.Violations[1], Violation{"header", "/X-Tenant", "is required"})
+
+	assert_Error_Response(t, callbackRequest(p, "PUT", "/charts/twelve", `{}`).Result(), http.StatusBadRequest)
+	assert_Error_Response(t, callbackRequest(p, "PUT", "/charts/12", `{"Name":1}`).Result(), http.StatusBadRequest)
+
+	assert_Foo_Response(t, callbackRequest(p, "POST", "/foos", `{"Name":"foo","Order":1}`).Result(), http.StatusOK, Foo{"foo", 2})
+	assert_Error_Response(t, callbackRequest(p, "POST", "/foos", `{"Name":"taken"}`).Result(), http.StatusConflict)
+	assert_Error_Response(t, callbackRequest(p, "POST", "/foos", ``).Result(), http.StatusBadRequest)
+	rw = callbackRequest(p, "POST", "/foos", `{"Order":1}`)
+	json.Unmarshal(rw.Body.Bytes(), &problem)
+	expect(t, rw.Code, http.StatusUnprocessableEntity)
+	expect(t, problem.Violations[0], Violation{"body", "/Name", "is required"})
+
+	expect(t, callbackRequest(p, "POST", "/optional", ``).Body.String(), "true")
+	expect(t, callbackRequest(p, "POST", "/optional", `{}`).Body.String(), "false")
+
+	preflight := httptest.NewRequest("OPTIONS", "/counts", nil)
+	preflight.Header.Set(HEADER_Access_Control_Request_Method, "POST")
+	rw = httptest.NewRecorder()
+	p.ServeHTTP(rw, preflight)
+	expect(t, rw.Code, http.StatusOK)
+	expect(t, rw.Body.String(), "0")
+	assert_Error_Response(t, callbackRequest(p, "POST", "/counts", ``).Result(), http.StatusBadRequest)
+
+	assert_Foo_Response(t, callbackRequest(p, "GET", "/foos/bar", ``).Result(), http.StatusOK, Foo{"bar", 1})
+
+	rw = callbackRequest(p, "GET", "/foos", ``)
+	expect(t, rw.Code, http.StatusOK)
+	expect(t, rw.Body.String(), `[{"Name":"foo","Order":1}]`)
+}
+
+func Test_Pastis_Handle_Body_Violations(t *testing.T) {
+	p := NewAPI()
+	Handle(p, "PUT", "/signups/:id", func(ctx context.Context, in struct {
+		ID     int    `path:"id"`
+		Signup signup `body:"" json:"signup"`
+	}) (int, error) {
+		return in.ID, nil
+	})
+	p.HandleFunc()
+
+	rw := callbackRequest(p, "PUT", "/signups/3", `{"name":"ann","email":"ann@example.com","age":30,"nickname":"an","addresses":[{}]}`)
+	var problem struct {
+		Violations Violations
+	}
+	json.Unmarshal(rw.Body.Bytes(), &problem)
+	expect(t, rw.Code, http.StatusUnprocessableEntity)
+	expect(t, len(problem.Violations), 1)
+	expect(t, problem.Violations[0], Violation{"body", "/addresses/0/city", "is required"})
+}
+
+func Test_Pastis_Handle_Invalid_Inputs(t *testing.T) {
+	p := NewAPI()
+	refute(t, Handle(p, "GET", "/channels", func(ctx context.Context, in struct {
+		Since chan int `query:"since"`
+	}) (Foo, error) {
+		return Foo{}, nil
+	}), nil)
+	refute(t, Handle(p, "POST", "/bodies", func(ctx context.Context, in struct {
+		A Foo `body:""`
+		B Foo `body:""`
+	}) (Foo, error) {
+		return Foo{}, nil
+	}), nil)
+	refute(t, Handle(p, "POST", "/both", func(ctx context.Context, in struct {
+		A Foo `body:"" query:"a"`
+	}) (Foo, error) {
+		return Foo{}, nil
+	}), nil)
+	refute(t, Handle(p, "POST", "/rules", func(ctx context.Context, in struct {
+		Name string `validate:"unknown"`
+	}) (Foo, error) {
+		return Foo{}, nil
+	}), nil)
+	//GET and HEAD requests have no body
+	refute(t, Handle(p, "GET", "/counts", func(ctx context.Context, in int) (int, error) {
+		return in, nil
+	}), nil)
+	refute(t, Handle(p, "HEAD", "/untagged", func(ctx context.Context, in struct{ Limit int }) (int, error) {
+		return in.Limit, nil
+	}), nil)
+	refute(t, Handle(p, "GET", "/bodies", func(ctx context.Context, in struct {
+		A Foo `body:""`
+	}) (Foo, error) {
+		return in.A, nil
+	}), nil)
+	expect(t, len(p.Routes()), 0)
+	expect(t, Handle(p, "POST", "/counts", func(ctx context.Context, in int) (int, error) {
+		return in, nil
+	}), nil)
+}
+
+func Test_Pastis_Handle_Group(t *testing.T) {
+	p := NewAPI()
+	admin := p.Group("/admin", func(rw http.ResponseWriter, request *http.Request, chain *FilterChain) {
+		rw.Header().Set("X-Admin", "true")
+		chain.NextFilter(rw, request)
+	})
+	expect(t, HandleGroup(admin, "GET", "/foos/:name", func(ctx context.Context, in struct {
+		Name string `path:"name"`
+	}) (Foo, error) {
+		return Foo{in.Name, 1}, nil
+	}), nil)
+	expect(t, HandleGroup(p.Host("api.example.com"), "POST", "/foos", func(ctx context.Context, in Foo) (Foo, error) {
+		return Foo{in.Name, in.Order + 1}, nil
+	}), nil)
+	p.HandleFunc()
+
+	rw := callbackRequest(p, "GET", "/admin/foos/bar", ``)
+	assert_Foo_Response(t, rw.Result(), http.StatusOK, Foo{"bar", 1})
+	expect(t, rw.Header().Get("X-Admin"), "true")
+
+	request := httptest.NewRequest("POST", "http://api.example.com/foos", strings.NewReader(`{"Name":"foo","Order":1}`))
+	rw = httptest.NewRecorder()
+	p.ServeHTTP(rw, request)
+	assert_Foo_Response(t, rw.Result(), http.StatusOK, Foo{"foo", 2})
+	expect(t, callbackRequest(p, "POST", "/foos", `{"Name":"foo"}`).Code, http.StatusNotFound)
+}
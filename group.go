@@ -0,0 +1,131 @@
+package pastis
+
+import (
+	"net/http"
+	"strings"
+)
+
+// A Group registers routes sharing a common URL-pattern prefix, a set of filters and possibly a host pattern.
+// The group filters are executed after the API filters and only for the routes of the group.
+type Group struct {
+	api *API
+	//prefix of the group routes
+	prefix string
+	//filters executed after the API ones
+	filters []Filter
+	//optional host pattern the group routes are restricted to
+	host string
+}
+
+// Group returns a group of routes whose URL-pattern starts with the given prefix.
+// The given filters only apply to the group routes, after the API filters.
+func (api *API) Group(prefix string, filters ...Filter) *Group {
+	return &Group{api: api, prefix: prefix, filters: filters}
+}
+
+// Host returns a group of routes restricted to the requests whose host matches the given pattern.
+// Host patterns are made of dot-separated labels which may be named parameters, as in :tenant.api.example.com.
+// The given filters only apply to the group routes, after the API filters.
+func (api *API) Host(pattern string, filters ...Filter) *Group {
+	return &Group{api: api, filters: filters, host: pattern}
+}
+
+// Group returns a nested group whose prefix and filters are appended to the ones of the group.
+func (g *Group) Group(prefix string, filters ...Filter) *Group {
+	groupFilters := append(append([]Filter{}, g.filters...), filters...)
+	return &Group{api: g.api, prefix: joinPattern(g.prefix, prefix), filters: groupFilters, host: g.host}
+}
+
+//routeOptions returns the options of a group route.
+func (g *Group) routeOptions(options []RouteOption) []RouteOption {
+	if g.host == "" {
+		return options
+	}
+	return append([]RouteOption{Host(g.host)}, options...)
+}
+
+//joinPattern appends an URL-pattern to a prefix.
+//Patterns anchored with ^ remain anchored in front of the prefix.
+func joinPattern(prefix string, pattern string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	anchor := ""
+	if strings.HasPrefix(pattern, "^") {
+		anchor, pattern = "^", pattern[1:]
+	}
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = "/" + pattern
+	}
+	return anchor + prefix + pattern
+}
+
+// AddFilter adds a new filter to the group. The group will execute the filter
+// after the API filters before calling the target function of the routes added afterwards.
+func (g *Group) AddFilter(filter Filter) {
+	g.filters = append(g.filters, filter)
+}
+
+// AddResource adds a new resource to the group, at the given path below the group prefix.
+func (g *Group) AddResource(pattern string, resource interface{}, options ...RouteOption) error {
+	return g.api.addResource(joinPattern(g.prefix, pattern), resource, g.filters, g.routeOptions(options))
+}
+
+// Function callback paired with a request Method and URL-matching pattern below the group prefix.
+func (g *Group) Do(requestMethod string, pattern string, fn interface{}, options ...RouteOption) error {
+	return g.api.do(requestMethod, joinPattern(g.prefix, pattern), fn, g.filters, g.routeOptions(options))
+}
+
+// Mount serves the requests whose path starts with the given prefix below the group prefix with the given handler.
+// The handler receives the requests with the path following the prefix, after the API and group filters unless the Unfiltered option is given.
+func (g *Group) Mount(prefix string, handler http.Handler, options ...RouteOption) error {
+	return g.api.mount(AnyMethod, joinPattern(g.prefix, prefix), handler, g.filters, g.routeOptions(options))
+}
+
+// Static serves the files of root below the given prefix below the group prefix, after the API and group filters.
+func (g *Group) Static(prefix string, root interface{}, options ...StaticOption) error {
+	return g.api.static(joinPattern(g.prefix, prefix), root, g.filters, g.routeOptions(nil), options)
+}
+
+// Function callback paired with GET Method and URL-matching pattern.
+func (g *Group) Get(pattern string, fn interface{}, options ...RouteOption) error {
+	return g.Do("GET", pattern, fn, options...)
+}
+
+// Function callback paired with PATCH Method and URL-matching pattern.
+func (g *Group) Patch(pattern string, fn interface{}, options ...RouteOption) error {
+	return g.Do("PATCH", pattern, fn, options...)
+}
+
+// Function callback paired with OPTIONS Method and URL-matching pattern.
+func (g *Group) Options(pattern string, fn interface{}, options ...RouteOption) error {
+	return g.Do("OPTIONS", pattern, fn, options...)
+}
+
+// Function callback paired with HEAD Method and URL-matching pattern.
+func (g *Group) Head(pattern string, fn interface{}, options ...RouteOption) error {
+	return g.Do("HEAD", pattern, fn, options...)
+}
+
+// Function callback paired with POST Method and URL-matching pattern.
+func (g *Group) Post(pattern string, fn interface{}, options ...RouteOption) error {
+	return g.Do("POST", pattern, fn, options...)
+}
+
+// Function callback paired with LINK Method and URL-matching pattern.
+func (g *Group) Link(pattern string, fn interface{}, options ...RouteOption) error {
+	return g.Do("LINK", pattern, fn, options...)
+}
+
+// Function callback paired with UNLINK Method and URL-matching pattern.
+func (g *Group) Unlink(pattern string, fn interface{}, options ...RouteOption) error {
+	return g.Do("UNLINK", pattern, fn, options...)
+}
+
+// Function callback paired with PUT Method and URL-matching pattern.
+func (g *Group) Put(pattern string, fn interface{}, options ...RouteOption) error {
+	return g.Do("PUT", pattern, fn, options...)
+}
+
+// Function callback paired with DELETE Method and URL-matching pattern.
+func (g *Group) Delete(fn interface{}, pattern string, options ...RouteOption) error {
+	return g.Do("DELETE", pattern, fn, options...)
+}
@@ -0,0 +1,114 @@
+package pastis
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+//tracingFilter returns a filter appending its name to the X-Trace response header.
+func tracingFilter(name string) Filter {
+	return func(rw http.ResponseWriter, request *http.Request, chain *FilterChain) {
+		rw.Header().Add("X-Trace", name)
+		chain.NextFilter(rw, request)
+	}
+}
+
+//authFilter rejects the requests having no Authorization header.
+func authFilter(rw http.ResponseWriter, request *http.Request, chain *FilterChain) {
+	if request.Header.Get("Authorization") == "" {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	chain.NextFilter(rw, request)
+}
+
+func Test_Pastis_Group_Routes(t *testing.T) {
+	p := NewAPI()
+	v1 := p.Group("/v1")
+	v1.Get("/hello/:name", func(params url.Values) (int, interface{}) {
+		return http.StatusOK, Foo{params.Get("name"), 1}
+	})
+	v1.AddResource("/foo", new(FooResource))
+	v1.Group("/nested/").AddResource("/:nestedname", new(NestedFooResource))
+	p.HandleFunc()
+
+	ts := httptest.NewServer(p)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/v1/hello/johnDoe")
+	if err != nil {
+		log.Fatal(err)
+	}
+	assert_Foo_Response(t, res, http.StatusOK, Foo{"johnDoe", 1})
+
+	res, err = http.Get(ts.URL + "/v1/foo")
+	if err != nil {
+		log.Fatal(err)
+	}
+	assert_Foo_Response(t, res, http.StatusOK, Foo{"name", 1})
+
+	res, err = http.Get(ts.URL + "/v1/nested/nestedFoo")
+	if err != nil {
+		log.Fatal(err)
+	}
+	assert_Foo_Response(t, res, http.StatusOK, Foo{"nestedFoo", 2})
+
+	res, err = http.Get(ts.URL + "/foo")
+	if err != nil {
+		log.Fatal(err)
+	}
+	expect(t, res.StatusCode, http.StatusNotFound)
+}
+
+func Test_Pastis_Group_Filters(t *testing.T) {
+	p := NewAPI()
+	p.AddFilter(tracingFilter("api"))
+	p.Get("/public", func() (int, interface{}) {
+		return http.StatusOK, nil
+	})
+	admin := p.Group("/admin", tracingFilter("admin"), authFilter)
+	admin.Get("/users", func() (int, interface{}) {
+		return http.StatusOK, nil
+	})
+	admin.Group("/audit", tracingFilter("audit")).Get("/logs", func() (int, interface{}) {
+		return http.StatusOK, nil
+	})
+	p.HandleFunc()
+
+	ts := httptest.NewServer(p)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/public")
+	if err != nil {
+		log.Fatal(err)
+	}
+	expect(t, res.StatusCode, http.StatusOK)
+	expect(t, strings.Join(res.Header["X-Trace"], ","), "api")
+
+	res, err = http.Get(ts.URL + "/admin/users")
+	if err != nil {
+		log.Fatal(err)
+	}
+	expect(t, res.StatusCode, http.StatusUnauthorized)
+	expect(t, strings.Join(res.Header["X-Trace"], ","), "api,admin")
+
+	request, _ := http.NewRequest("GET", ts.URL+"/admin/audit/logs", nil)
+	request.Header.Set("Authorization", "Token")
+	res, err = http.DefaultClient.Do(request)
+	if err != nil {
+		log.Fatal(err)
+	}
+	expect(t, res.StatusCode, http.StatusOK)
+	expect(t, strings.Join(res.Header["X-Trace"], ","), "api,admin,audit")
+}
+
+func Test_Pastis_Join_Pattern(t *testing.T) {
+	expect(t, joinPattern("/v1", "/foo"), "/v1/foo")
+	expect(t, joinPattern("/v1/", "foo"), "/v1/foo")
+	expect(t, joinPattern("/v1", "/"), "/v1/")
+	expect(t, joinPattern("/v1", "^/comment/(?P<id>\\d+)$"), "^/v1/comment/(?P<id>\\d+)$")
+}
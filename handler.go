@@ -16,11 +16,13 @@ package pastis
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"reflect"
+	"runtime/debug"
 	"strings"
 )
 
@@ -38,14 +40,59 @@ type API struct {
 	router *Router
 	//A configurable logger
 	logger *Logger
+	//The router handler, once the routes are defined
+	handler http.HandlerFunc
+	//Optional mapper of the errors returned by the callbacks
+	errorMapper ErrorMapper
+	//Problem answered when a required request body is empty, nil when empty bodies are accepted
+	emptyBody *Problem
 }
 
 // NewAPI allocates and returns a new API.
 func NewAPI() *API {
-	return &API{chain: &FilterChain{[]Filter{}, 0, nil}, mux: http.NewServeMux(), router: NewRouter(), logger: GetLogger("DEBUG")}
+	return &API{chain: &FilterChain{[]Filter{}, 0, nil}, mux: http.NewServeMux(), router: NewRouter(), logger: GetLogger("DEBUG"),
+		emptyBody: NewProblem(http.StatusBadRequest, errEmptyBody.Error()).With("code", "empty_body")}
 }
 
 
+//SetStrict makes the API panic instead of returning an error when a route cannot be added: when it conflicts with a route added
+//previously or when its callback is not supported, including the parameter structs and validation rules of its arguments.
+//Since the route functions are often called without checking their error, a strict API makes sure no route is silently left out.
+func (api *API) SetStrict(strict bool) {
+	api.router.Strict = strict
+}
+
+//SetPathPolicy sets how the API handles the request paths that differ from the route patterns
+//by their trailing slash, duplicate slashes or dot segments.
+func (api *API) SetPathPolicy(policy PathPolicy) {
+	api.router.PathPolicy = policy
+}
+
+//SetErrorMapper sets the mapper of the errors returned by the callbacks that do not implement HTTPError.
+//Without mapper, such errors are answered with 500 Internal Server Error.
+func (api *API) SetErrorMapper(mapper ErrorMapper) {
+	api.errorMapper = mapper
+}
+
+//SetEmptyBodyProblem sets the problem answered when the body of a request is empty while the callback requires one,
+//that is when its body argument is not a pointer. By default, it is a 400 Bad Request problem of code empty_body.
+//It is never answered to OPTIONS and HEAD requests, whose callbacks receive the zero value of their body argument.
+//A nil problem lets the callbacks receive the zero value of their body argument.
+func (api *API) SetEmptyBodyProblem(problem *Problem) {
+	api.emptyBody = problem
+}
+
+//SetMethodOverride lets the clients that can only send GET and POST requests reach the routes of other methods:
+//a POST request is routed to the method given by its X-HTTP-Method-Override header or its _method form field,
+//provided that the method is one of the given ones (PUT, PATCH and DELETE when none is given).
+//Other overriding methods are ignored and the request is routed as a POST request.
+func (api *API) SetMethodOverride(methods ...string) {
+	if len(methods) == 0 {
+		methods = defaultOverridableMethods
+	}
+	api.router.MethodOverride = normalizeMethods(methods)
+}
+
 func (api *API)  SetLevel(level string) {
 	api.logger.SetLevel(level)
 }
@@ -58,118 +105,140 @@ func (api *API) SetOutput(level string, w io.Writer, flag int) *Logger {
 }
 
 //A Pretty Error response
+//Note that the errors generated by pastis are rendered as problems (see Problem).
 func ErrorResponse(err error) interface{} {
 	return map[string]string{"error": err.Error()}
 }
 
-//Return an instance of http.HandlerFunc built from  a pair of request method and a callback value.
-//The first callback input parameter is the set of URL query and path parameters.
-//The second callback input parameter is the unmarshalled JSON body recieved from the request (if it exists).
-func (api *API) handleMethodCall(urlValues url.Values, request *http.Request, methodRef reflect.Value) (int, interface{}) {
-	api.logger.Debugf("handleMethodCall %s", request.Method)
-
-	if methodRef.Kind() == reflect.Invalid {
-		return http.StatusNotImplemented, nil
+//Calls the callback with the arguments resolved from the request.
+func (api *API) handleMethodCall(rw http.ResponseWriter, request *http.Request, cb *callback) (int, interface{}) {
+	if cb.direct != nil {
+		return api.handleReturn(cb.direct(request))
 	}
 
-	methodType := methodRef.Type()
-	methodArgSize := methodRef.Type().NumIn()
-
-	api.logger.Debugf("method has %d argument.", methodArgSize)
-
-	if methodArgSize >= 3 {
-		api.logger.Errorf("method %v cannot have more than 2 arguments", methodRef)
-		return http.StatusNotImplemented, nil
-	}
-
-	if methodArgSize == 0 {
-		api.logger.Errorf("method %v has no argument. Skip marshalling...", methodRef)
-		return api.handleReturn(methodRef, []reflect.Value{})
-	}
-
-	valueOfUrlValues := reflect.ValueOf(urlValues)
-	methodParameterValues := []reflect.Value{valueOfUrlValues}
-
-	expectedJSONType := methodType.In(0)
-
-	if methodArgSize == 1 {
-		if expectedJSONType == valueOfUrlValues.Type() {
-			api.logger.Debugf(" method has one argument of type url.Values. Skip marshalling...")
-			return api.handleReturn(methodRef, methodParameterValues)
-		} else {
-			api.logger.Debugf(" method %v has one argument of request body type. ", methodRef)
-			methodParameterValues = []reflect.Value{} // will add later the json body as parameter
+	args := make([]reflect.Value, len(cb.resolvers))
+	var violations Violations
+	for i, resolve := range cb.resolvers {
+		arg, err := resolve(rw, request)
+		if err == errEmptyBody && (api.emptyBody == nil || bodiless(request.Method)) {
+			err = nil
 		}
-	} else if methodArgSize == 2 {
-		api.logger.Debug(" method first argument is not the request body type.\n")
-		expectedJSONType = methodType.In(1)
-		api.logger.Debugf(" method second argument is the request body type %v.\n", expectedJSONType)
-	}
-
-	expectedJSONValue := reflect.New(expectedJSONType)
-
-	jsonInterface := expectedJSONValue.Interface()
-
-	dec := json.NewDecoder(request.Body)
-	for {
-		if err := dec.Decode(jsonInterface); err == io.EOF {
-			break
-		} else if err != nil {
-			api.logger.Error(" unable to decode json blob. Check whether parameter type matches json type. \n")
-			return http.StatusNotImplemented, nil
+		//violations of every argument are answered together
+		if invalid, ok := err.(Violations); ok {
+			violations = append(violations, invalid...)
+			err = nil
 		}
+		if err != nil {
+			return api.argumentError(request, err)
+		}
+		args[i] = arg
 	}
+	if len(violations) > 0 {
+		return api.argumentError(request, violations)
+	}
+	return api.handleReturn(cb.results(cb.fn.Call(args)))
+}
 
-	jsonValue := reflect.ValueOf(jsonInterface)
-	jsonValueType := jsonValue.Elem().Type()
-
-	if expectedJSONType.Kind() != jsonValue.Elem().Type().Kind() {
-		api.logger.Errorf(" Unexpected JSON format. Should be of type '", expectedJSONType.Kind(), "' instead of ", jsonValueType.Kind())
-		return http.StatusNotImplemented, nil
-	} else if expectedJSONType != jsonValue.Type() {
-		methodParameterValues = append(methodParameterValues, jsonValue.Elem())
+//argumentError returns the status code and the problem answered when the callback arguments cannot be resolved from the request:
+//the problem set for empty bodies, 422 Unprocessable Entity for Violations and 400 Bad Request otherwise (see argumentProblem).
+func (api *API) argumentError(request *http.Request, err error) (int, interface{}) {
+	api.logger.Debugf(" unable to resolve the callback arguments: %v", err)
+	var problem *Problem
+	if violations, ok := err.(Violations); ok {
+		problem = NewProblem(http.StatusUnprocessableEntity, "the request is invalid").With("code", "invalid_request").With("violations", violations)
+	} else if err == errEmptyBody {
+		//the problem is copied since it is shared by the requests
+		emptyBody := *api.emptyBody
+		problem = &emptyBody
 	} else {
-		api.logger.Errorf(" Parameter type mismatches json type. Expected JSON format. ", expectedJSONType)
-		return http.StatusNotImplemented, nil
+		problem = argumentProblem(err)
 	}
-	return api.handleReturn(methodRef, methodParameterValues)
+	problem.Instance = request.URL.Path
+	return problem.Status, problem
 }
 
-//Handles the return values. It converts the array of Value into a tuple (int, interface {} )
-func (api *API) handleReturn(methodRef reflect.Value, methodParameterValues []reflect.Value) (int, interface{}) {
-	responseValues := methodRef.Call(methodParameterValues)
-	if len(responseValues) != 2 {
-		api.logger.Errorf(" method %v does not return expected response (int, interface{}).", methodRef)
-		return http.StatusNotImplemented, nil
+//Handles the converted return values. It returns them as a tuple (int, interface {} ), mapping the returned error if any.
+func (api *API) handleReturn(code int, data interface{}, err error) (int, interface{}) {
+	if err != nil {
+		return api.mapError(err)
+	}
+	return code, data
+}
+
+//mapError returns the status code and the response content of an error returned by a callback.
+//Problems are answered as they are and other errors implementing HTTPError give the status code and the detail of a problem.
+//Remaining errors are mapped by the error mapper of the API or answered with 500 Internal Server Error when there is none.
+func (api *API) mapError(err error) (int, interface{}) {
+	var problem *Problem
+	if errors.As(err, &problem) {
+		return problem.Status, problem
+	}
+	var httpErr HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode(), NewProblem(httpErr.StatusCode(), httpErr.PublicMessage())
+	}
+	if api.errorMapper != nil {
+		return api.errorMapper(err)
 	}
-	return int(responseValues[0].Int()), responseValues[1].Interface()
+	api.logger.Errorf(" callback failed: %v", err)
+	return http.StatusInternalServerError, NewProblem(http.StatusInternalServerError, "the request could not be handled")
 }
 
 //Return an instance of http.HandlerFunc built from  a request method, a URL-pattern matching and a callback function fn.
-//The first callback input parameter is the set of URL query and path parameters.
-//The second callback input parameter is the unmarshalled JSON body recieved from the request (if it exists).
-func (api *API) methodHandler(pattern string, requestMethod string, fn reflect.Value) http.HandlerFunc {
+//The callback arguments are injected according to their type and its results are converted once it returns (see newCallback).
+//An error is returned when the callback signature is not supported.
+func (api *API) methodHandler(pattern string, requestMethod string, fn reflect.Value) (http.HandlerFunc, error) {
+	cb, err := newCallback(fn)
+	if err != nil {
+		return nil, api.rejectRoute(fmt.Errorf("%s %s: %v", requestMethod, pattern, err))
+	}
 	return func(rw http.ResponseWriter, request *http.Request) {
 
-		code, data := api.handleMethodCall(request.Form, request, fn)
+		code, data := api.handleMethodCall(rw, request, cb)
 
 		api.handlerFuncReturn(code, data, rw)
-	}
+	}, nil
 }
 
-//Utility method writing status code and data to the given response
+//Utility method writing status code and data to the given response.
+//When a media type other than JSON was negotiated for the route, string and []byte data are written as they are.
 func (api *API) handlerFuncReturn(code int, data interface{}, rw http.ResponseWriter) {
 	api.logger.Debugf(" handlerFuncReturn %v", code)
 
+	if code == http.StatusNoContent {
+		rw.WriteHeader(code)
+		return
+	}
+
+	switch data.(type) {
+	case Problem, *Problem:
+		rw.Header().Set("Content-Type", MediaTypeProblem)
+	}
+
+	contentType := rw.Header().Get("Content-Type")
+	if contentType != "" && !isJSON(contentType) {
+		switch raw := data.(type) {
+		case []byte:
+			rw.WriteHeader(code)
+			rw.Write(raw)
+			return
+		case string:
+			rw.WriteHeader(code)
+			io.WriteString(rw, raw)
+			return
+		}
+	}
+
 	content, err := json.Marshal(data)
 	if err != nil {
-		api.logger.Errorf(" handlerFuncReturn could not marshall content [%v]", data)
-		rw.WriteHeader(http.StatusInternalServerError)
+		api.logger.Errorf(" handlerFuncReturn could not marshall content [%v]: %v", data, err)
+		writeProblem(rw, NewProblem(http.StatusInternalServerError, "the response could not be written"))
 		return
 	}
 
-	//FIXME should be configurable
-	rw.Header().Set("Content-Type", "application/json")
+	if !isJSON(contentType) {
+		rw.Header().Set("Content-Type", "application/json")
+	}
 
 	rw.WriteHeader(code)
 
@@ -184,91 +253,274 @@ func (api *API) AddFilter(filter Filter) {
 	api.chain.Filters = append(api.chain.Filters, filter)
 }
 
+// Routes returns the description of every route of the API, sorted by host, pattern and method.
+func (api *API) Routes() []RouteInfo {
+	return api.router.Routes()
+}
+
+// URLFor builds the path of the route having the given name, substituting its path parameters with the given values.
+// It returns an error when a parameter is missing or does not satisfy its constraint.
+func (api *API) URLFor(name string, params url.Values) (string, error) {
+	return api.router.URLFor(name, params)
+}
+
+// AddConstraint registers a named constraint that path parameters may declare in URL-patterns, as in /charts/:id<name>.
+// The parameter value must fully match the regular expression expr for the route to match.
+func (api *API) AddConstraint(name string, expr string) error {
+	return api.router.AddConstraint(name, expr)
+}
+
 // AddResource adds a new resource to an API. The API will route
 // requests that match the given path to its HTTP
 // method on the resource.
-func (api *API) AddResource(pattern string, resource interface{}) {
+func (api *API) AddResource(pattern string, resource interface{}, options ...RouteOption) error {
+	return api.addResource(pattern, resource, nil, options)
+}
+
+//addResource adds the methods of a resource filtered by the given filters after the API ones.
+//The callbacks of every method are analysed before any of them is added, so that either all the methods are added or none of them.
+//It returns the first error met while adding the resource methods.
+func (api *API) addResource(pattern string, resource interface{}, filters []Filter, options []RouteOption) error {
+	var routes []*route
 	methods := []string{"GET", "Get", "Put", "PUT", "Post", "POST", "Patch", "PATCH", "DELETE", "Delete", "Options", "OPTIONS"}
-	for _, requestMethod := range methods {
-		methodRef := reflect.ValueOf(resource).MethodByName(requestMethod)
+	for _, methodName := range methods {
+		methodRef := reflect.ValueOf(resource).MethodByName(methodName)
 		if methodRef.Kind() != reflect.Invalid {
-			requestMethod = strings.ToUpper(requestMethod)
-			handler := api.methodHandler(pattern, requestMethod, methodRef)
-			api.addHandler(requestMethod, handler, pattern)
-			api.logger.Debugf(" Added Resource [method={%v},pattern={%v}]", requestMethod, pattern)
+			requestMethod := strings.ToUpper(methodName)
+			handler, err := api.methodHandler(pattern, requestMethod, methodRef)
+			if err != nil {
+				return err
+			}
+			handlerName := fmt.Sprintf("%T.%s", resource, methodName)
+			routes = append(routes, api.newRoute(requestMethod, handler, handlerName, pattern, filters, options))
 		}
 	}
+	if err := api.addRoutes(routes...); err != nil {
+		return err
+	}
+	for _, r := range routes {
+		api.logger.Debugf(" Added Resource [method={%v},pattern={%v}]", r.method, pattern)
+	}
+	return nil
 }
 
 // Function callback paired with a request Method and URL-matching pattern.
-func (api *API) Do(requestMethod string, pattern string, fn interface{}) {
-	handler := api.methodHandler(pattern, requestMethod, reflect.ValueOf(fn))
-	api.addHandler(requestMethod, handler, pattern)
+// The route is not added when the callback is not supported or when the route conflicts with a route added previously:
+// Do and the other route functions then return an error, unless the API is strict and panics (see SetStrict).
+func (api *API) Do(requestMethod string, pattern string, fn interface{}, options ...RouteOption) error {
+	return api.do(requestMethod, pattern, fn, nil, options)
+}
+
+//do adds a function callback filtered by the given filters after the API ones.
+func (api *API) do(requestMethod string, pattern string, fn interface{}, filters []Filter, options []RouteOption) error {
+	handler, err := api.methodHandler(pattern, requestMethod, reflect.ValueOf(fn))
+	if err != nil {
+		return err
+	}
+	if err := api.addHandler(requestMethod, handler, funcName(fn), pattern, filters, options); err != nil {
+		return err
+	}
 	api.logger.Debugf(" Added Do [method={%v},pattern={%v}]", requestMethod, pattern)
+	return nil
+}
+
+// AddRoute adds a function callback paired with a request method and URL-matching pattern, possibly while the API serves requests.
+// The route serves the requests received once AddRoute returns, so that endpoints can be enabled without restarting the API.
+func (api *API) AddRoute(requestMethod string, pattern string, fn interface{}, options ...RouteOption) error {
+	return api.do(requestMethod, pattern, fn, nil, options)
+}
+
+// RemoveRoute removes the route paired with the given request method and URL-matching pattern, possibly while the API serves requests.
+// Routes restricted to a host pattern are removed with the Host option. Mounted handlers and static files are removed with RemoveMount.
+// The requests received once RemoveRoute returns are no longer routed to the removed route.
+func (api *API) RemoveRoute(requestMethod string, pattern string, options ...RouteOption) error {
+	if err := api.router.Remove(pattern, requestMethod, options...); err != nil {
+		api.logger.Errorf(" Could not remove route: %v", err)
+		return err
+	}
+	api.logger.Debugf(" Removed route [method={%v},pattern={%v}]", requestMethod, pattern)
+	return nil
+}
+
+// RemoveMount removes the handler mounted below the given prefix by Mount or Static, possibly while the API serves requests.
+// Handlers restricted to a host pattern are removed with the Host option.
+// The requests received once RemoveMount returns are no longer routed to the removed handler.
+func (api *API) RemoveMount(prefix string, options ...RouteOption) error {
+	if err := api.router.RemoveMount(prefix, options...); err != nil {
+		api.logger.Errorf(" Could not remove mount: %v", err)
+		return err
+	}
+	api.logger.Debugf(" Removed mount [prefix={%v}]", prefix)
+	return nil
+}
+
+// Mount serves the requests whose path starts with the given prefix with the given handler, whatever their method.
+// The handler receives the requests with the path following the prefix, after the API filters unless the Unfiltered option is given.
+// The prefix may include named parameters but no regular expression.
+func (api *API) Mount(prefix string, handler http.Handler, options ...RouteOption) error {
+	return api.mount(AnyMethod, prefix, handler, nil, options)
+}
+
+//mount mounts an handler for the given method, filtered by the given filters after the API ones.
+func (api *API) mount(method string, prefix string, handler http.Handler, filters []Filter, options []RouteOption) error {
+	pattern := joinPattern(prefix, "/**")
+	options = append(append([]RouteOption{}, options...), mounted)
+	if err := api.addHandler(method, handler.ServeHTTP, funcName(handler), pattern, filters, options); err != nil {
+		return err
+	}
+	api.logger.Debugf(" Mounted [pattern={%v}]", pattern)
+	return nil
 }
 
 // Function callback paired with GET Method and URL-matching pattern.
-func (api *API) Get(pattern string, fn interface{}) {
-	api.Do("GET", pattern, fn)
+func (api *API) Get(pattern string, fn interface{}, options ...RouteOption) error {
+	return api.Do("GET", pattern, fn, options...)
 }
 
 // Function callback paired with PATH Method and URL-matching pattern.
-func (api *API) Patch(pattern string, fn interface{}) {
-	api.Do("PATCH", pattern, fn)
+func (api *API) Patch(pattern string, fn interface{}, options ...RouteOption) error {
+	return api.Do("PATCH", pattern, fn, options...)
 }
 
 // Function callback paired with OPTIONS Method and URL-matching pattern.
-func (api *API) Options(pattern string, fn interface{}) {
-	api.Do("OPTIONS", pattern, fn)
+func (api *API) Options(pattern string, fn interface{}, options ...RouteOption) error {
+	return api.Do("OPTIONS", pattern, fn, options...)
 }
 
 // Function callback paired with HEAD Method and URL-matching pattern.
-func (api *API) Head(pattern string, fn interface{}) {
-	api.Do("HEAD", pattern, fn)
+func (api *API) Head(pattern string, fn interface{}, options ...RouteOption) error {
+	return api.Do("HEAD", pattern, fn, options...)
 }
 
 // Function callback paired with POST Method and URL-matching pattern.
-func (api *API) Post(pattern string, fn interface{}) {
-	api.Do("POST", pattern, fn)
+func (api *API) Post(pattern string, fn interface{}, options ...RouteOption) error {
+	return api.Do("POST", pattern, fn, options...)
 }
 
 // Function callback paired with LINK Method and URL-matching pattern.
-func (api *API) Link(pattern string, fn interface{}) {
-	api.Do("LINK", pattern, fn)
+func (api *API) Link(pattern string, fn interface{}, options ...RouteOption) error {
+	return api.Do("LINK", pattern, fn, options...)
 }
 
 // Function callback paired with UNLINK Method and URL-matching pattern.
-func (api *API) Unlink(pattern string, fn interface{}) {
-	api.Do("UNLINK", pattern, fn)
+func (api *API) Unlink(pattern string, fn interface{}, options ...RouteOption) error {
+	return api.Do("UNLINK", pattern, fn, options...)
 }
 
 // Function callback paired with PUT Method and URL-matching pattern.
-func (api *API) Put(pattern string, fn interface{}) {
-	api.Do("PUT", pattern, fn)
+func (api *API) Put(pattern string, fn interface{}, options ...RouteOption) error {
+	return api.Do("PUT", pattern, fn, options...)
 }
 
 // Function callback paired with DELETE Method and URL-matching pattern.
-func (api *API) Delete(fn interface{}, pattern string) {
-	api.Do("DELETE", pattern, fn)
+func (api *API) Delete(fn interface{}, pattern string, options ...RouteOption) error {
+	return api.Do("DELETE", pattern, fn, options...)
 }
 
 // Function callback paired with a set of URL-matching pattern.
-func (api *API) addHandler(method string, handler http.HandlerFunc, pattern string) {
+//The handler is filtered by the API filters and then by the given ones.
+//It returns an error when the route conflicts with a route added previously.
+func (api *API) addHandler(method string, handler http.HandlerFunc, handlerName string, pattern string, filters []Filter, options []RouteOption) error {
+	return api.addRoutes(api.newRoute(method, handler, handlerName, pattern, filters, options))
+}
+
+//newRoute returns the route of an handler filtered by the API filters and then by the given ones.
+func (api *API) newRoute(method string, handler http.HandlerFunc, handlerName string, pattern string, filters []Filter, options []RouteOption) *route {
 	api.logger.Debugf(" Add Handle Func [pattern={%v}]", pattern)
+	allFilters := append(append([]Filter{}, api.chain.Filters...), filters...)
+	if isUnfiltered(options) {
+		allFilters = nil
+	} else {
+		handler = api.filter(handler, filters...)
+	}
+	options = append([]RouteOption{describe(handlerName, filterNames(allFilters))}, options...)
+	return newRoute(pattern, method, handler, options)
+}
+
+//addRoutes adds all the given routes or none of them, returning the error of the first route that cannot be added.
+func (api *API) addRoutes(routes ...*route) error {
+	err := api.router.addRoutes(routes...)
+	if err != nil {
+		api.logger.Errorf(" Could not add route: %v", err)
+	}
+	return err
+}
+
+//rejectRoute logs the error preventing a route from being added and returns it, or panics with it when the API is strict.
+func (api *API) rejectRoute(err error) error {
+	api.logger.Errorf(" Could not add route: %v", err)
+	if api.router.Strict {
+		panic(err)
+	}
+	return err
+}
+
+//filter returns the given handler wrapped into the API filter chain followed by the given filters.
+func (api *API) filter(handler http.HandlerFunc, filters ...Filter) http.HandlerFunc {
 	pathChain := api.chain.Copy()
+	pathChain.Filters = append(append([]Filter{}, pathChain.Filters...), filters...)
 	pathChain.Target = handler
-	handlerFunc := pathChain.dispatchRequestHandler()
-	api.router.Add(pattern, method, handlerFunc)
+	return pathChain.dispatchRequestHandler()
+}
+
+//errorHandler returns an handler writing the given status code along with a problem detailed by the given message.
+func (api *API) errorHandler(code int, message func(*http.Request) string) http.HandlerFunc {
+	return func(rw http.ResponseWriter, request *http.Request) {
+		problem := NewProblem(code, message(request))
+		problem.Instance = request.URL.Path
+		writeProblem(rw, problem)
+	}
+}
+
+//recoverer returns the given handler answering the requests whose handling panics with 500 Internal Server Error.
+//The panic value is logged but not exposed to the client.
+func (api *API) recoverer(handler http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, request *http.Request) {
+		defer func() {
+			if v := recover(); v != nil {
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				api.logger.Errorf(" panic handling %s %s: %v\n%s", request.Method, request.URL.Path, v, debug.Stack())
+				problem := NewProblem(http.StatusInternalServerError, "the request could not be handled")
+				problem.Instance = request.URL.Path
+				writeProblem(rw, problem)
+			}
+		}()
+		handler(rw, request)
+	}
 }
 
 //Implements HandlerFunc
+//Once HandleFunc is called, requests are routed as they are received so that the path policy applies
+//rather than the path cleaning of the HTTP mutex.
 func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if api.handler != nil {
+		api.handler(w, r)
+		return
+	}
 	handler, _ := api.mux.Handler(r)
 	handler.ServeHTTP(w, r)
 }
 
 func (api *API) HandleFunc() {
-	api.mux.HandleFunc("/", api.router.Handler(api.logger))
+	api.router.NotFound = api.filter(api.errorHandler(http.StatusNotFound, func(request *http.Request) string {
+		return fmt.Sprintf("no resource matches %s", request.URL.Path)
+	}))
+	api.router.MethodNotAllowed = api.filter(api.errorHandler(http.StatusMethodNotAllowed, func(request *http.Request) string {
+		return fmt.Sprintf("method %s is not allowed on %s", request.Method, request.URL.Path)
+	}))
+	api.router.DefaultOptions = api.filter(func(rw http.ResponseWriter, request *http.Request) {
+		rw.WriteHeader(http.StatusNoContent)
+	})
+	api.router.NotAcceptable = api.filter(api.errorHandler(http.StatusNotAcceptable, func(request *http.Request) string {
+		return fmt.Sprintf("no representation of %s matches %s", request.URL.Path, request.Header.Get("Accept"))
+	}))
+	api.router.UnsupportedMediaType = api.filter(api.errorHandler(http.StatusUnsupportedMediaType, func(request *http.Request) string {
+		return fmt.Sprintf("media type %s is not supported by %s %s", request.Header.Get("Content-Type"), request.Method, request.URL.Path)
+	}))
+	api.handler = api.recoverer(api.router.Handler(api.logger))
+	api.mux.HandleFunc("/", api.handler)
 	api.router.OpsFriendlyLog(api.logger)
 }
 
@@ -277,7 +529,7 @@ func (api *API) Start(port int) error {
 	api.HandleFunc()
 	portString := fmt.Sprintf(":%d", port)
 
-	err := http.ListenAndServe(portString, api.mux)
+	err := http.ListenAndServe(portString, api)
 	if err != nil {
 		api.logger.Errorf(" API could not start at port %d \n", port)
 		return err
@@ -2,6 +2,7 @@ package pastis
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -9,7 +10,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 	"reflect"
 )
 
@@ -217,3 +221,464 @@ func Test_Pastis_POST_Having_Input_Handler(t *testing.T) {
 	}
 	assert_Foo_Response(t, res, http.StatusOK, foo)
 }
+
+type contextKey string
+
+func Test_Pastis_Callback_Injection(t *testing.T) {
+	p := NewAPI()
+	p.AddFilter(func(rw http.ResponseWriter, request *http.Request, chain *FilterChain) {
+		chain.NextFilter(rw, request.WithContext(context.WithValue(request.Context(), contextKey("user"), "alice")))
+	})
+	p.Post("/charts/:id", func(header http.Header, input Foo, ctx context.Context, rw http.ResponseWriter, params url.Values, request *http.Request) (int, interface{}) {
+		rw.Header().Set("X-Chart", params.Get("id"))
+		name := fmt.Sprintf("%s %s %s %s", input.Name, header.Get("Authorization"), ctx.Value(contextKey("user")), request.Method)
+		return http.StatusOK, Foo{name, input.Order}
+	})
+	p.Get("/header", func(header http.Header) (int, interface{}) {
+		return http.StatusOK, Foo{header.Get("Authorization"), 1}
+	})
+	refute(t, p.Post("/bodies", func(input Foo, other Foo) (int, interface{}) {
+		return http.StatusOK, input
+	}), nil)
+	p.HandleFunc()
+
+	request := httptest.NewRequest("POST", "/charts/12", strings.NewReader(`{"Name":"chart","Order":3}`))
+	request.Header.Set("Authorization", "Bearer token")
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, request)
+	assert_Foo_Response(t, rw.Result(), http.StatusOK, Foo{"chart Bearer token alice POST", 3})
+	expect(t, rw.Header().Get("X-Chart"), "12")
+
+	request = httptest.NewRequest("GET", "/header", nil)
+	request.Header.Set("Authorization", "Basic xyz")
+	rw = httptest.NewRecorder()
+	p.ServeHTTP(rw, request)
+	assert_Foo_Response(t, rw.Result(), http.StatusOK, Foo{"Basic xyz", 1})
+}
+
+func Test_Pastis_Static_Route_Precedence(t *testing.T) {
+	p := NewAPI()
+	p.Get("/dashboards/:dashboardid", func(vals url.Values) (int, interface{}) {
+		return http.StatusOK, Foo{vals.Get("dashboardid"), 1}
+	})
+	p.Get("/dashboards/new", func(vals url.Values) (int, interface{}) {
+		return http.StatusOK, Foo{"new", 2}
+	})
+	p.HandleFunc()
+
+	ts := httptest.NewServer(p)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/dashboards/new")
+	if err != nil {
+		log.Fatal(err)
+	}
+	assert_Foo_Response(t, res, http.StatusOK, Foo{"new", 2})
+
+	res, err = http.Get(ts.URL + "/dashboards/1")
+	if err != nil {
+		log.Fatal(err)
+	}
+	assert_Foo_Response(t, res, http.StatusOK, Foo{"1", 1})
+}
+
+func assert_Error_Response(t *testing.T, res *http.Response, expectedStatusCode int) {
+	expect(t, res.StatusCode, expectedStatusCode)
+	expect(t, res.Header.Get("Content-Type"), MediaTypeProblem)
+	var problem Problem
+	if err := json.NewDecoder(res.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, problem.Status, expectedStatusCode)
+	expect(t, problem.Title, http.StatusText(expectedStatusCode))
+	refute(t, problem.Detail, "")
+}
+
+func Test_Pastis_Not_Found(t *testing.T) {
+	p := NewAPI()
+	p.Get("/foo", func() (int, interface{}) {
+		return http.StatusOK, nil
+	})
+	p.HandleFunc()
+
+	ts := httptest.NewServer(p)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/bar")
+	if err != nil {
+		log.Fatal(err)
+	}
+	assert_Error_Response(t, res, http.StatusNotFound)
+	expect(t, res.Header.Get("Allow"), "")
+}
+
+func Test_Pastis_Unmarshallable_Response(t *testing.T) {
+	p := NewAPI()
+	p.logger.SetLevel("OFF")
+	p.Get("/foo", func() (int, interface{}) {
+		return http.StatusOK, make(chan int)
+	})
+	p.HandleFunc()
+
+	assert_Error_Response(t, callbackRequest(p, "GET", "/foo", "").Result(), http.StatusInternalServerError)
+}
+
+func Test_Pastis_Method_Not_Allowed(t *testing.T) {
+	p := NewAPI()
+	p.AddResource("/foo", new(FooResource))
+	p.Put("/foo", func() (int, interface{}) {
+		return http.StatusOK, nil
+	})
+	p.HandleFunc()
+
+	ts := httptest.NewServer(p)
+	defer ts.Close()
+
+	res, err := http.Post(ts.URL+"/foo", "application/json", nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	assert_Error_Response(t, res, http.StatusMethodNotAllowed)
+	expect(t, res.Header.Get("Allow"), "GET, HEAD, OPTIONS, PUT")
+}
+
+func Test_Pastis_Constrained_Path_Parameter(t *testing.T) {
+	p := NewAPI()
+	p.Get("/charts/:id<int>", func(vals url.Values) (int, interface{}) {
+		return http.StatusOK, Foo{vals.Get("id"), 1}
+	})
+	p.HandleFunc()
+
+	ts := httptest.NewServer(p)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/charts/12")
+	if err != nil {
+		log.Fatal(err)
+	}
+	assert_Foo_Response(t, res, http.StatusOK, Foo{"12", 1})
+
+	res, err = http.Get(ts.URL + "/charts/twelve")
+	if err != nil {
+		log.Fatal(err)
+	}
+	assert_Error_Response(t, res, http.StatusNotFound)
+}
+
+func Test_Pastis_Automatic_HEAD(t *testing.T) {
+	p := NewAPI()
+	p.AddResource("/foo", new(FooResource))
+	p.HandleFunc()
+
+	ts := httptest.NewServer(p)
+	defer ts.Close()
+
+	get, err := http.Get(ts.URL + "/foo")
+	if err != nil {
+		log.Fatal(err)
+	}
+	res, err := http.Head(ts.URL + "/foo")
+	if err != nil {
+		log.Fatal(err)
+	}
+	expect(t, res.StatusCode, http.StatusOK)
+	expect(t, res.Header.Get("Content-Type"), "application/json")
+	expect(t, res.ContentLength, get.ContentLength)
+	body, _ := ioutil.ReadAll(res.Body)
+	expect(t, len(body), 0)
+}
+
+func Test_Pastis_Automatic_OPTIONS(t *testing.T) {
+	p := NewAPI()
+	p.AddResource("/foo", new(FooResource))
+	p.Post("/foo", func() (int, interface{}) {
+		return http.StatusCreated, nil
+	})
+	p.Options("/bar", func() (int, interface{}) {
+		return http.StatusOK, Foo{"options", 1}
+	})
+	p.HandleFunc()
+
+	ts := httptest.NewServer(p)
+	defer ts.Close()
+
+	request, _ := http.NewRequest("OPTIONS", ts.URL+"/foo", nil)
+	res, err := http.DefaultClient.Do(request)
+	if err != nil {
+		log.Fatal(err)
+	}
+	expect(t, res.StatusCode, http.StatusNoContent)
+	expect(t, res.Header.Get("Allow"), "GET, HEAD, OPTIONS, POST")
+
+	request, _ = http.NewRequest("OPTIONS", ts.URL+"/bar", nil)
+	res, err = http.DefaultClient.Do(request)
+	if err != nil {
+		log.Fatal(err)
+	}
+	assert_Foo_Response(t, res, http.StatusOK, Foo{"options", 1})
+
+	request, _ = http.NewRequest("OPTIONS", ts.URL+"/unknown", nil)
+	res, err = http.DefaultClient.Do(request)
+	if err != nil {
+		log.Fatal(err)
+	}
+	expect(t, res.StatusCode, http.StatusNotFound)
+}
+
+func Test_Pastis_Route_Conflict(t *testing.T) {
+	p := NewAPI()
+	expect(t, p.AddResource("/foo/:id", new(FooResource)), nil)
+	refute(t, p.Get("/foo/:name", func() (int, interface{}) {
+		return http.StatusOK, nil
+	}), nil)
+	refute(t, p.Group("/foo").AddResource("/:id", new(NestedFooResource)), nil)
+
+	p.SetStrict(true)
+	defer func() {
+		refute(t, recover(), nil)
+	}()
+	p.Get("/foo/:other", func() (int, interface{}) {
+		return http.StatusOK, nil
+	})
+	t.Error("strict API did not panic")
+}
+
+func Test_Pastis_Strict_Unsupported_Callback(t *testing.T) {
+	p := NewAPI()
+	p.logger.SetLevel("OFF")
+	refute(t, p.Get("/charts", func() (Foo, int) {
+		return Foo{}, http.StatusOK
+	}), nil)
+
+	p.SetStrict(true)
+	panics := func(add func()) (panicked bool) {
+		defer func() {
+			panicked = recover() != nil
+		}()
+		add()
+		return false
+	}
+	expect(t, panics(func() {
+		p.Get("/charts", func() (Foo, int) {
+			return Foo{}, http.StatusOK
+		})
+	}), true)
+	expect(t, panics(func() {
+		Handle(p, "GET", "/channels", func(ctx context.Context, in struct {
+			Since chan int `query:"since"`
+		}) (Foo, error) {
+			return Foo{}, nil
+		})
+	}), true)
+	expect(t, panics(func() {
+		p.Get("/foos", func() (Foo, error) {
+			return Foo{}, nil
+		})
+	}), false)
+}
+
+func Test_Pastis_Path_Redirect_Policy(t *testing.T) {
+	p := NewAPI()
+	p.SetPathPolicy(PathRedirect)
+	p.AddResource("/foo", new(FooResource))
+	p.HandleFunc()
+
+	ts := httptest.NewServer(p)
+	defer ts.Close()
+
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(ts.URL + "//foo/")
+	if err != nil {
+		log.Fatal(err)
+	}
+	expect(t, res.StatusCode, http.StatusMovedPermanently)
+	expect(t, res.Header.Get("Location"), "/foo")
+
+	res, err = http.Get(ts.URL + "//foo/")
+	if err != nil {
+		log.Fatal(err)
+	}
+	assert_Foo_Response(t, res, http.StatusOK, Foo{"name", 1})
+}
+
+func Test_Pastis_Mount(t *testing.T) {
+	echo := http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		fmt.Fprintf(rw, "%s %s %s", request.Method, request.URL.Path, request.Form.Get("tenant"))
+	})
+	nested := NewAPI()
+	nested.AddResource("/foo", new(FooResource))
+	nested.HandleFunc()
+
+	p := NewAPI()
+	p.AddFilter(tracingFilter("api"))
+	p.Mount("/debug", echo)
+	p.Mount("/raw", echo, Unfiltered())
+	p.Group("/tenants/:tenant").Mount("/echo", echo)
+	p.Mount("/nested", nested)
+	p.Get("/debug/vars", func() (int, interface{}) {
+		return http.StatusOK, Foo{"vars", 1}
+	})
+	p.HandleFunc()
+
+	ts := httptest.NewServer(p)
+	defer ts.Close()
+
+	cases := []struct {
+		method   string
+		path     string
+		expected string
+		trace    string
+	}{
+		{"GET", "/debug", "GET / ", "api"},
+		{"DELETE", "/debug/pprof/heap", "DELETE /pprof/heap ", "api"},
+		{"POST", "/raw/x", "POST /x ", ""},
+		{"PUT", "/tenants/acme/echo/y/", "PUT /y/ acme", "api"},
+	}
+	for _, c := range cases {
+		request, _ := http.NewRequest(c.method, ts.URL+c.path, nil)
+		res, err := http.DefaultClient.Do(request)
+		if err != nil {
+			log.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		expect(t, string(body), c.expected)
+		expect(t, res.Header.Get("X-Trace"), c.trace)
+	}
+
+	res, err := http.Get(ts.URL + "/debug/vars")
+	if err != nil {
+		log.Fatal(err)
+	}
+	assert_Foo_Response(t, res, http.StatusOK, Foo{"vars", 1})
+
+	res, err = http.Get(ts.URL + "/nested/foo")
+	if err != nil {
+		log.Fatal(err)
+	}
+	assert_Foo_Response(t, res, http.StatusOK, Foo{"name", 1})
+
+	routes := p.Routes()
+	expect(t, routes[0].Method, AnyMethod)
+	expect(t, routes[0].Pattern, "/debug/**")
+	refute(t, p.Mount("^/regexp/(?P<id>\\d+)", echo), nil)
+}
+
+func Test_Pastis_Remove_Mount(t *testing.T) {
+	echo := http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		fmt.Fprintf(rw, "%s %s", request.Method, request.URL.Path)
+	})
+	p := NewAPI()
+	p.SetLevel("OFF")
+	p.Mount("/debug", echo)
+	p.Mount("/debug", echo, Host("admin.example.com"))
+	p.Static("/assets", fstest.MapFS{"app.js": {Data: []byte("console.log('app')")}})
+	p.Get("/assets/version", func() (int, interface{}) {
+		return http.StatusOK, Foo{"version", 1}
+	})
+	p.HandleFunc()
+
+	expect(t, p.RemoveMount("/debug"), nil)
+	expect(t, p.RemoveMount("/assets"), nil)
+	refute(t, p.RemoveMount("/assets"), nil)
+	refute(t, p.RemoveMount("/assets/version"), nil)
+	expect(t, len(p.Routes()), 2)
+
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest("GET", "/debug/vars", nil))
+	expect(t, rw.Code, http.StatusNotFound)
+	rw = httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest("GET", "http://admin.example.com/debug/vars", nil))
+	expect(t, rw.Body.String(), "GET /vars")
+	rw = httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest("GET", "/assets/app.js", nil))
+	expect(t, rw.Code, http.StatusNotFound)
+	rw = httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest("GET", "/assets/version", nil))
+	assert_Foo_Response(t, rw.Result(), http.StatusOK, Foo{"version", 1})
+
+	expect(t, p.RemoveMount("/debug", Host("admin.example.com")), nil)
+	expect(t, len(p.Routes()), 1)
+}
+
+func Test_Pastis_Runtime_Routes(t *testing.T) {
+	p := NewAPI()
+	p.SetLevel("OFF")
+	p.AddFilter(tracingFilter("api"))
+	p.Get("/stable", func() (int, interface{}) {
+		return http.StatusOK, Foo{"stable", 1}
+	})
+	p.HandleFunc()
+
+	toggle := func(params url.Values) (int, interface{}) {
+		return http.StatusOK, Foo{params.Get("name"), 2}
+	}
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				rw := httptest.NewRecorder()
+				p.ServeHTTP(rw, httptest.NewRequest("GET", "/stable", nil))
+				if rw.Code != http.StatusOK || rw.Header().Get("X-Trace") != "api" {
+					t.Errorf("stable route answered %d", rw.Code)
+				}
+				rw = httptest.NewRecorder()
+				p.ServeHTTP(rw, httptest.NewRequest("GET", "/toggles/foo", nil))
+				if rw.Code != http.StatusOK && rw.Code != http.StatusNotFound {
+					t.Errorf("toggled route answered %d", rw.Code)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		expect(t, p.AddRoute("GET", "/toggles/:name", toggle, Name("toggle")), nil)
+		expect(t, p.AddRoute("GET", fmt.Sprintf("/plugins/%d", i), toggle), nil)
+		expect(t, p.RemoveRoute("GET", "/toggles/:name"), nil)
+	}
+	close(done)
+	wg.Wait()
+
+	refute(t, p.RemoveRoute("GET", "/toggles/:name"), nil)
+	expect(t, len(p.Routes()), 201)
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest("GET", "/toggles/foo", nil))
+	expect(t, rw.Code, http.StatusNotFound)
+	p.AddRoute("GET", "/toggles/:name", toggle)
+	rw = httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest("GET", "/toggles/foo", nil))
+	assert_Foo_Response(t, rw.Result(), http.StatusOK, Foo{"foo", 2})
+}
+
+func Test_Pastis_Encoded_Slashes(t *testing.T) {
+	echo := http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		fmt.Fprintf(rw, "%s %s", request.URL.Path, request.URL.EscapedPath())
+	})
+	p := NewAPI()
+	p.SetLevel("OFF")
+	p.Get("/repos/:name/files/*path", func(params url.Values) (int, interface{}) {
+		return http.StatusOK, Foo{params.Get("name") + " " + params.Get("path"), 1}
+	})
+	p.Mount("/proxy", echo)
+	p.HandleFunc()
+
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest("GET", "/repos/acme%2Fapi/files/docs/a%2Fb%25.md", nil))
+	assert_Foo_Response(t, rw.Result(), http.StatusOK, Foo{"acme/api docs/a/b%.md", 1})
+
+	rw = httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest("GET", "/repos/acme/files/docs/readme.md", nil))
+	assert_Foo_Response(t, rw.Result(), http.StatusOK, Foo{"acme docs/readme.md", 1})
+
+	rw = httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest("GET", "/proxy/buckets/a%2Fb/c", nil))
+	expect(t, rw.Body.String(), "/buckets/a/b/c /buckets/a%2Fb/c")
+}
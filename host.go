@@ -0,0 +1,110 @@
+package pastis
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+//hostTable is the table of the routes restricted to a host pattern.
+type hostTable struct {
+	table
+	pattern string
+	//labels of the host pattern, from left to right
+	labels []segment
+}
+
+//hostTable returns a copy of the table of the given host pattern that may be modified, adding the table if needed.
+//It returns an error when a parameter label of the pattern is invalid or refers to an unknown constraint.
+func (rt *routing) hostTable(pattern string) (*table, error) {
+	if t, _ := rt.findHostTable(pattern); t != nil {
+		return t, nil
+	}
+	if err := rt.checkConstraints(pattern); err != nil {
+		return nil, err
+	}
+	h := &hostTable{table: table{root: &node{}}, pattern: pattern}
+	for _, label := range strings.Split(pattern, ".") {
+		if !strings.HasPrefix(label, ":") {
+			h.labels = append(h.labels, segment{kind: staticSegment, value: strings.ToLower(label)})
+			continue
+		}
+		name, c, ok := rt.parseParam(label[1:])
+		if !ok {
+			return nil, fmt.Errorf("invalid parameter label %s of host pattern %s", label, pattern)
+		}
+		h.labels = append(h.labels, segment{kind: paramSegment, value: name, constraint: c})
+	}
+	//host tables are kept from the most specific host pattern to the least specific one, then in the order they were added
+	i := 0
+	for i < len(rt.hosts) && !h.moreSpecific(rt.hosts[i]) {
+		i++
+	}
+	rt.hosts = append(rt.hosts[:i], append([]*hostTable{h}, rt.hosts[i:]...)...)
+	return &h.table, nil
+}
+
+//moreSpecific reports whether the host pattern is more specific than another one having as many labels:
+//going from the leftmost label to the rightmost, a literal label beats a parameter.
+func (h *hostTable) moreSpecific(other *hostTable) bool {
+	if len(h.labels) != len(other.labels) {
+		return false
+	}
+	for i, label := range h.labels {
+		if label.kind != other.labels[i].kind {
+			return label.kind == staticSegment
+		}
+	}
+	return false
+}
+
+//findHostTable returns a copy of the table of the given host pattern that may be modified, along with its index.
+//It returns nil when there is no such table.
+func (rt *routing) findHostTable(pattern string) (*table, int) {
+	for i, h := range rt.hosts {
+		if h.pattern == pattern {
+			c := &hostTable{table: h.copy(), pattern: h.pattern, labels: h.labels}
+			rt.hosts[i] = c
+			return &c.table, i
+		}
+	}
+	return nil, -1
+}
+
+//match reports whether the given host matches the host pattern and returns its parameters.
+func (h *hostTable) match(host string) (bool, map[string]string) {
+	labels := strings.Split(host, ".")
+	if len(labels) != len(h.labels) {
+		return false, nil
+	}
+	params := make(map[string]string)
+	for i, label := range h.labels {
+		switch {
+		case label.kind == staticSegment && label.value != strings.ToLower(labels[i]):
+			return false, nil
+		case label.kind == paramSegment:
+			if labels[i] == "" || (label.constraint != nil && !label.constraint.regexp.MatchString(labels[i])) {
+				return false, nil
+			}
+			params[label.value] = labels[i]
+		}
+	}
+	return true, params
+}
+
+//tables returns the route tables serving the given host along with their host parameters:
+//the tables of the host patterns matching the host, from the most specific one, followed by the table of the routes serving any host.
+func (rt *routing) tables(host string) ([]*table, []map[string]string) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	var tables []*table
+	var hostParams []map[string]string
+	for _, h := range rt.hosts {
+		if ok, params := h.match(host); ok {
+			tables = append(tables, &h.table)
+			hostParams = append(hostParams, params)
+		}
+	}
+	return append(tables, &rt.table), append(hostParams, nil)
+}
@@ -0,0 +1,126 @@
+package pastis
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func Test_Pastis_Router_Host_Tables(t *testing.T) {
+	router := NewRouter()
+	router.Add("/dashboards", "GET", nil, Host("admin.api.example.com"))
+	router.Add("/dashboards", "GET", nil, Host(":tenant.api.example.com"))
+	router.Add("/dashboards", "GET", nil)
+	router.Add("/charts/:id", "GET", nil, Host(":tenant<int>.charts.example.com"))
+
+	r, params := router.load().match("admin.api.example.com", "GET", "/dashboards", nil)
+	expect(t, r.host, "admin.api.example.com")
+	expect(t, len(params), 0)
+
+	r, params = router.load().match("Acme.API.example.com:8080", "GET", "/dashboards", nil)
+	expect(t, r.host, ":tenant.api.example.com")
+	expect(t, params["tenant"], "Acme")
+
+	r, _ = router.load().match("example.com", "GET", "/dashboards", nil)
+	expect(t, r.host, "")
+
+	r, params = router.load().match("12.charts.example.com", "GET", "/charts/3", nil)
+	expect(t, r.host, ":tenant<int>.charts.example.com")
+	expect(t, params["tenant"], "12")
+	expect(t, params["id"], "3")
+
+	r, _ = router.load().match("acme.charts.example.com", "GET", "/charts/3", nil)
+	expect(t, r == nil, true)
+	expect(t, len(router.load().allowedMethods("acme.charts.example.com", "/charts/3")), 0)
+	expect(t, fmt.Sprint(router.load().allowedMethods("12.charts.example.com", "/charts/3")), "[GET HEAD OPTIONS]")
+
+	//invalid parameter labels are rejected rather than matched literally
+	err := router.Add("/charts", "GET", nil, Host(":sub<nope>.example.com"))
+	expect(t, err.Error(), "invalid parameter sub of pattern :sub<nope>.example.com: unknown constraint <nope>")
+	refute(t, router.Add("/charts", "GET", nil, Host(":.example.com")), nil)
+	refute(t, router.Add("/charts", "GET", nil, Host(":sub<[a-.example.com>")), nil)
+	expect(t, len(router.load().hosts), 3)
+}
+
+func Test_Pastis_Host_Routes(t *testing.T) {
+	p := NewAPI()
+	p.Host("admin.api.example.com").Get("/whoami", func() (int, interface{}) {
+		return http.StatusOK, Foo{"admin", 1}
+	})
+	p.Host(":tenant.api.example.com").Group("/v1").Get("/whoami", func(params url.Values) (int, interface{}) {
+		return http.StatusOK, Foo{params.Get("tenant"), 2}
+	})
+	p.HandleFunc()
+
+	cases := []struct {
+		host     string
+		path     string
+		expected Foo
+	}{
+		{"admin.api.example.com", "/whoami", Foo{"admin", 1}},
+		{"acme.api.example.com", "/v1/whoami", Foo{"acme", 2}},
+	}
+	for _, c := range cases {
+		request, _ := http.NewRequest("GET", "http://"+c.host+c.path, nil)
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, request)
+		expect(t, rw.Code, http.StatusOK)
+		var f Foo
+		json.Unmarshal(rw.Body.Bytes(), &f)
+		expect(t, f, c.expected)
+	}
+
+	request, _ := http.NewRequest("GET", "http://acme.api.example.com/whoami", nil)
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, request)
+	expect(t, rw.Code, http.StatusNotFound)
+}
+
+func Test_Pastis_Host_Specificity(t *testing.T) {
+	p := NewAPI()
+	p.Host(":tenant.api.example.com").Get("/whoami", func(params url.Values) (int, interface{}) {
+		return http.StatusOK, Foo{"tenant " + params.Get("tenant"), 1}
+	})
+	p.Host(":tenant.api.example.com").Get("/reports", func(params url.Values) (int, interface{}) {
+		return http.StatusOK, Foo{"reports " + params.Get("tenant"), 1}
+	})
+	p.Host("admin.api.example.com").Get("/whoami", func() (int, interface{}) {
+		return http.StatusOK, Foo{"admin", 2}
+	})
+	p.Host("admin.api.example.com").Get("/only-admin", func() (int, interface{}) {
+		return http.StatusOK, Foo{"only admin", 2}
+	})
+	p.Get("/status", func() (int, interface{}) {
+		return http.StatusOK, Foo{"any", 3}
+	})
+	p.HandleFunc()
+
+	cases := []struct {
+		host     string
+		path     string
+		expected Foo
+	}{
+		{"admin.api.example.com", "/whoami", Foo{"admin", 2}},
+		{"admin.api.example.com", "/only-admin", Foo{"only admin", 2}},
+		{"admin.api.example.com", "/reports", Foo{"reports admin", 1}},
+		{"admin.api.example.com", "/status", Foo{"any", 3}},
+		{"acme.api.example.com", "/whoami", Foo{"tenant acme", 1}},
+	}
+	for _, c := range cases {
+		request, _ := http.NewRequest("GET", "http://"+c.host+c.path, nil)
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, request)
+		expect(t, rw.Code, http.StatusOK)
+		var f Foo
+		json.Unmarshal(rw.Body.Bytes(), &f)
+		expect(t, f, c.expected)
+	}
+
+	request, _ := http.NewRequest("GET", "http://acme.api.example.com/only-admin", nil)
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, request)
+	expect(t, rw.Code, http.StatusNotFound)
+}
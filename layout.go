@@ -0,0 +1,164 @@
+package pastis
+
+import (
+	"reflect"
+	"time"
+	"unsafe"
+)
+
+//The binders and validators of the callback arguments are generated from their types when the route is added.
+//They then access the values through their address, according to the layout of their type, so that binding and
+//validating a request does not go through reflection.
+
+//eface is the layout of an interface{} value: the type of the value along with a pointer to the value,
+//or the value itself when the type is a pointer.
+type eface struct {
+	typ  unsafe.Pointer
+	data unsafe.Pointer
+}
+
+//sliceHeader is the layout of a slice value.
+type sliceHeader struct {
+	data unsafe.Pointer
+	len  int
+	cap  int
+}
+
+//typeWordOf returns the type word of the interface values holding a value of type t, which is not an interface type.
+func typeWordOf(t reflect.Type) unsafe.Pointer {
+	v := reflect.New(t).Elem().Interface()
+	return (*eface)(unsafe.Pointer(&v)).typ
+}
+
+//interfaceAt returns the interface value of the type given by its type word (see typeWordOf) and data word:
+//the pointer itself for a pointer type, or the address of the value for a type that is not pointer-shaped,
+//such as a string, a number or a struct of several fields.
+func interfaceAt(typ unsafe.Pointer, data unsafe.Pointer) interface{} {
+	var v interface{}
+	e := (*eface)(unsafe.Pointer(&v))
+	e.typ, e.data = typ, data
+	return v
+}
+
+//timeType is the type of the common parameters holding pointers, allocated apart from the other ones.
+var timeType = reflect.TypeOf(time.Time{})
+
+//hasPointers reports whether the values of a type hold pointers that the garbage collector follows.
+func hasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Array:
+		return t.Len() > 0 && hasPointers(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.Func, reflect.Interface, reflect.String, reflect.Slice, reflect.UnsafePointer:
+		return true
+	}
+	return false
+}
+
+//newOf returns the function allocating a zero value of type t.
+//Only the values of the types holding pointers other than strings and time.Time are allocated through reflection.
+func newOf(t reflect.Type) func() unsafe.Pointer {
+	switch {
+	case t.Kind() == reflect.String:
+		return func() unsafe.Pointer { return unsafe.Pointer(new(string)) }
+	case t == timeType:
+		return func() unsafe.Pointer { return unsafe.Pointer(new(time.Time)) }
+	case !hasPointers(t):
+		words := int(t.Size()+7) / 8
+		if words == 0 {
+			words = 1
+		}
+		return func() unsafe.Pointer { return unsafe.Pointer(&make([]uint64, words)[0]) }
+	}
+	return func() unsafe.Pointer { return reflect.New(t).UnsafePointer() }
+}
+
+//makeSliceOf returns the function setting the slice of type t at p to a new slice of n zero elements, and returning its data.
+//Only the slices whose elements hold pointers other than strings and time.Time are made through reflection.
+func makeSliceOf(t reflect.Type) func(p unsafe.Pointer, n int) unsafe.Pointer {
+	elem := t.Elem()
+	switch {
+	case elem.Kind() == reflect.String:
+		return func(p unsafe.Pointer, n int) unsafe.Pointer {
+			*(*[]string)(p) = make([]string, n)
+			return (*sliceHeader)(p).data
+		}
+	case elem == timeType:
+		return func(p unsafe.Pointer, n int) unsafe.Pointer {
+			*(*[]time.Time)(p) = make([]time.Time, n)
+			return (*sliceHeader)(p).data
+		}
+	case !hasPointers(elem):
+		size := int(elem.Size())
+		return func(p unsafe.Pointer, n int) unsafe.Pointer {
+			words := (n*size + 7) / 8
+			if words == 0 {
+				words = 1
+			}
+			*(*sliceHeader)(p) = sliceHeader{unsafe.Pointer(&make([]uint64, words)[0]), n, n}
+			return (*sliceHeader)(p).data
+		}
+	}
+	return func(p unsafe.Pointer, n int) unsafe.Pointer {
+		reflect.NewAt(t, p).Elem().Set(reflect.MakeSlice(t, n, n))
+		return (*sliceHeader)(p).data
+	}
+}
+
+//intOf returns the function reading a signed integer of the given size.
+func intOf(size uintptr) func(p unsafe.Pointer) int64 {
+	switch size {
+	case 1:
+		return func(p unsafe.Pointer) int64 { return int64(*(*int8)(p)) }
+	case 2:
+		return func(p unsafe.Pointer) int64 { return int64(*(*int16)(p)) }
+	case 4:
+		return func(p unsafe.Pointer) int64 { return int64(*(*int32)(p)) }
+	}
+	return func(p unsafe.Pointer) int64 { return *(*int64)(p) }
+}
+
+//uintOf returns the function reading an unsigned integer of the given size.
+func uintOf(size uintptr) func(p unsafe.Pointer) uint64 {
+	switch size {
+	case 1:
+		return func(p unsafe.Pointer) uint64 { return uint64(*(*uint8)(p)) }
+	case 2:
+		return func(p unsafe.Pointer) uint64 { return uint64(*(*uint16)(p)) }
+	case 4:
+		return func(p unsafe.Pointer) uint64 { return uint64(*(*uint32)(p)) }
+	}
+	return func(p unsafe.Pointer) uint64 { return *(*uint64)(p) }
+}
+
+//storeOf returns the function storing the low bits of an integer into an integer of the given size, signed or not.
+func storeOf(size uintptr) func(p unsafe.Pointer, bits uint64) {
+	switch size {
+	case 1:
+		return func(p unsafe.Pointer, bits uint64) { *(*uint8)(p) = uint8(bits) }
+	case 2:
+		return func(p unsafe.Pointer, bits uint64) { *(*uint16)(p) = uint16(bits) }
+	case 4:
+		return func(p unsafe.Pointer, bits uint64) { *(*uint32)(p) = uint32(bits) }
+	}
+	return func(p unsafe.Pointer, bits uint64) { *(*uint64)(p) = bits }
+}
+
+//floatOf returns the function reading a floating-point number of the given size.
+func floatOf(size uintptr) func(p unsafe.Pointer) float64 {
+	if size == 4 {
+		return func(p unsafe.Pointer) float64 { return float64(*(*float32)(p)) }
+	}
+	return func(p unsafe.Pointer) float64 { return *(*float64)(p) }
+}
+
+//mapLen returns the length of the map at p, whatever its key and element types.
+func mapLen(p unsafe.Pointer) int {
+	return len(*(*map[unsafe.Pointer]unsafe.Pointer)(p))
+}
@@ -0,0 +1,208 @@
+package pastis
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Consumes restricts a route to the requests whose Content-Type is one of the given media types.
+// Media types may be wildcards such as text/* and the requests having no Content-Type are accepted.
+// Routes of the same method and pattern may then be distinguished by the media types they consume.
+func Consumes(mediaTypes ...string) RouteOption {
+	return func(r *route) {
+		r.consumes = normalizeMediaTypes(mediaTypes)
+	}
+}
+
+// Produces declares the media types a route responds with, in order of preference.
+// The route is chosen when the request Accept header accepts one of them, and the best accepted type is set as
+// the response Content-Type before the handler is called.
+// Routes of the same method and pattern may then be distinguished by the media types they produce.
+func Produces(mediaTypes ...string) RouteOption {
+	return func(r *route) {
+		r.produces = normalizeMediaTypes(mediaTypes)
+	}
+}
+
+//normalizeMediaTypes returns the given media types trimmed and lower-cased.
+func normalizeMediaTypes(mediaTypes []string) []string {
+	normalized := make([]string, len(mediaTypes))
+	for i, mediaType := range mediaTypes {
+		normalized[i] = strings.ToLower(strings.TrimSpace(mediaType))
+	}
+	return normalized
+}
+
+//mediaBase returns a media type without its parameters.
+func mediaBase(mediaType string) string {
+	if i := strings.IndexByte(mediaType, ';'); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	return strings.TrimSpace(mediaType)
+}
+
+//mediaMatches reports whether a media type matches a media range such as */*, text/* or text/csv.
+func mediaMatches(mediaRange string, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	return strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, mediaRange[:len(mediaRange)-1])
+}
+
+//specificity ranks a media range: */* is less specific than text/*, itself less specific than text/csv.
+func specificity(mediaRange string) int {
+	switch {
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*"):
+		return 1
+	}
+	return 2
+}
+
+//isJSON reports whether a media type is JSON or a JSON based media type such as application/problem+json.
+func isJSON(mediaType string) bool {
+	base := mediaBase(mediaType)
+	return base == "application/json" || strings.HasSuffix(base, "+json")
+}
+
+//mediaRange is an element of an Accept header.
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+//negotiation holds the media types of a request that choose among the routes differing by the media types they consume and produce.
+type negotiation struct {
+	//media type of the request body, without its parameters
+	contentType string
+	//media ranges of the Accept header
+	accept []mediaRange
+}
+
+//newNegotiation reads the media types of a request.
+func newNegotiation(request *http.Request) *negotiation {
+	n := &negotiation{}
+	if contentType := request.Header.Get("Content-Type"); contentType != "" {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+			n.contentType = mediaType
+		} else {
+			n.contentType = strings.ToLower(mediaBase(contentType))
+		}
+	}
+	for _, accept := range request.Header.Values("Accept") {
+		for _, element := range strings.Split(accept, ",") {
+			if strings.TrimSpace(element) == "" {
+				continue
+			}
+			mediaType, params, err := mime.ParseMediaType(element)
+			if err != nil {
+				continue
+			}
+			if mediaType == "*" {
+				mediaType = "*/*"
+			}
+			quality := 1.0
+			if q, ok := params["q"]; ok {
+				if quality, err = strconv.ParseFloat(q, 64); err != nil {
+					continue
+				}
+			}
+			n.accept = append(n.accept, mediaRange{mediaType, quality})
+		}
+	}
+	return n
+}
+
+//choose returns the first route consuming the request content type among the ones producing the media type of highest quality.
+//When no negotiation is given, the first route is returned.
+func (n *negotiation) choose(routes []*route) *route {
+	if n == nil {
+		if len(routes) == 0 {
+			return nil
+		}
+		return routes[0]
+	}
+	var best *route
+	var bestQuality float64
+	bestSpecificity := -1
+	for _, r := range routes {
+		if !r.accepts(n.contentType) {
+			continue
+		}
+		if _, quality, spec := r.negotiate(n.accept); quality > bestQuality || (quality == bestQuality && quality > 0 && spec > bestSpecificity) {
+			best, bestQuality, bestSpecificity = r, quality, spec
+		}
+	}
+	return best
+}
+
+//accepts reports whether the route consumes the given request content type.
+func (r *route) accepts(contentType string) bool {
+	if len(r.consumes) == 0 || contentType == "" {
+		return true
+	}
+	for _, consumed := range r.consumes {
+		if mediaMatches(mediaBase(consumed), contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+//negotiate returns the media type produced by the route which is the most accepted by the given media ranges,
+//along with its quality and the specificity of the media range accepting it.
+//Routes producing no declared media type are accepted whatever the media ranges.
+func (r *route) negotiate(accept []mediaRange) (string, float64, int) {
+	if len(r.produces) == 0 {
+		return "", 1, 0
+	}
+	if len(accept) == 0 {
+		return r.produces[0], 1, 0
+	}
+	var best string
+	var bestQuality float64
+	bestSpecificity := -1
+	for _, produced := range r.produces {
+		base := mediaBase(produced)
+		//the most specific media range matching the type gives its quality
+		quality, spec := 0.0, -1
+		for _, m := range accept {
+			if s := specificity(m.mediaType); s > spec && mediaMatches(m.mediaType, base) {
+				quality, spec = m.quality, s
+			}
+		}
+		if quality > bestQuality || (quality == bestQuality && quality > 0 && spec > bestSpecificity) {
+			best, bestQuality, bestSpecificity = produced, quality, spec
+		}
+	}
+	return best, bestQuality, bestSpecificity
+}
+
+//overlaps reports whether both routes may be chosen for the same request, that is when the media types
+//they consume overlap and so do the media types they produce. Routes declaring no media type overlap with any route.
+func (r *route) overlaps(other *route) bool {
+	return mediaOverlap(r.consumes, other.consumes) && mediaOverlap(r.produces, other.produces)
+}
+
+//mediaOverlap reports whether two lists of media types have a media type in common, an empty list standing for any media type.
+func mediaOverlap(a []string, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for _, x := range a {
+		for _, y := range b {
+			if mediaMatches(mediaBase(x), mediaBase(y)) || mediaMatches(mediaBase(y), mediaBase(x)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//sameMedia reports whether both routes declare the same media types.
+func (r *route) sameMedia(other *route) bool {
+	return strings.Join(r.consumes, ",") == strings.Join(other.consumes, ",") && strings.Join(r.produces, ",") == strings.Join(other.produces, ",")
+}
@@ -0,0 +1,130 @@
+package pastis
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_Pastis_Negotiation_Choose(t *testing.T) {
+	router := NewRouter()
+	router.Add("/reports", "GET", routerTestHandler, Produces("application/json"))
+	router.Add("/reports", "GET", routerTestHandler, Produces("application/pdf", "text/csv"))
+	router.Add("/reports", "POST", routerTestHandler, Consumes("application/json"))
+	router.Add("/reports", "POST", routerTestHandler, Consumes("text/*"))
+
+	choose := func(method string, contentType string, accept string) *route {
+		request := httptest.NewRequest(method, "/reports", nil)
+		if contentType != "" {
+			request.Header.Set("Content-Type", contentType)
+		}
+		if accept != "" {
+			request.Header.Set("Accept", accept)
+		}
+		r, _ := router.load().match("", method, "/reports", newNegotiation(request))
+		return r
+	}
+	produced := func(r *route, accept string) string {
+		request := httptest.NewRequest("GET", "/reports", nil)
+		request.Header.Set("Accept", accept)
+		mediaType, _, _ := r.negotiate(newNegotiation(request).accept)
+		return mediaType
+	}
+
+	r := choose("GET", "", "")
+	expect(t, strings.Join(r.produces, ","), "application/json")
+	r = choose("GET", "", "application/pdf")
+	expect(t, strings.Join(r.produces, ","), "application/pdf,text/csv")
+	r = choose("GET", "", "text/*;q=0.9, application/json;q=0.5")
+	expect(t, produced(r, "text/*;q=0.9, application/json;q=0.5"), "text/csv")
+	r = choose("GET", "", "*/*;q=0.1, application/json")
+	expect(t, strings.Join(r.produces, ","), "application/json")
+	r = choose("GET", "", "*/*")
+	expect(t, strings.Join(r.produces, ","), "application/json")
+	r = choose("GET", "", "application/*, application/pdf;q=0")
+	expect(t, strings.Join(r.produces, ","), "application/json")
+	expect(t, choose("GET", "", "image/png") == nil, true)
+
+	r = choose("POST", "application/json; charset=utf-8", "")
+	expect(t, strings.Join(r.consumes, ","), "application/json")
+	r = choose("POST", "text/csv", "")
+	expect(t, strings.Join(r.consumes, ","), "text/*")
+	r = choose("POST", "", "")
+	expect(t, strings.Join(r.consumes, ","), "application/json")
+	expect(t, choose("POST", "application/xml", "") == nil, true)
+}
+
+func Test_Pastis_Negotiation_Conflicts(t *testing.T) {
+	router := NewRouter()
+	expect(t, router.Add("/reports", "GET", routerTestHandler, Produces("application/json")), nil)
+	refute(t, router.Add("/reports", "GET", routerTestHandler), nil)
+	refute(t, router.Add("/reports", "GET", routerTestHandler, Produces("application/*")), nil)
+	expect(t, router.Add("/reports", "GET", routerTestHandler, Produces("text/csv")), nil)
+	expect(t, router.Add("/reports", "POST", routerTestHandler, Consumes("text/csv")), nil)
+	refute(t, router.Add("/reports", "POST", routerTestHandler, Consumes("*/*")), nil)
+
+	refute(t, router.Remove("/reports", "GET"), nil)
+	expect(t, router.Remove("/reports", "GET", Produces("text/csv")), nil)
+	routes := router.Routes()
+	expect(t, len(routes), 2)
+	expect(t, strings.Join(routes[0].Produces, ","), "application/json")
+}
+
+func Test_Pastis_Negotiated_Responses(t *testing.T) {
+	p := NewAPI()
+	p.Get("/reports/:id", func() (int, interface{}) {
+		return http.StatusOK, Foo{"report", 1}
+	}, Produces("application/json"))
+	p.Get("/reports/:id", func() (int, interface{}) {
+		return http.StatusOK, "id,name\n1,report\n"
+	}, Produces("text/csv"))
+	p.Post("/reports", func() (int, interface{}) {
+		return http.StatusCreated, Foo{"json", 1}
+	}, Consumes("application/json"))
+	p.Post("/reports", func() (int, interface{}) {
+		return http.StatusCreated, Foo{"csv", 1}
+	}, Consumes("text/csv"))
+	p.HandleFunc()
+
+	ts := httptest.NewServer(p)
+	defer ts.Close()
+
+	do := func(method string, path string, contentType string, accept string) *http.Response {
+		request, _ := http.NewRequest(method, ts.URL+path, strings.NewReader("1,report"))
+		request.Header.Set("Content-Type", contentType)
+		request.Header.Set("Accept", accept)
+		res, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := do("GET", "/reports/1", "", "application/json")
+	assert_Foo_Response(t, res, http.StatusOK, Foo{"report", 1})
+
+	res = do("GET", "/reports/1", "", "text/csv, application/json;q=0.5")
+	expect(t, res.StatusCode, http.StatusOK)
+	expect(t, res.Header.Get("Content-Type"), "text/csv")
+	expect(t, res.Header.Get("Vary"), "Accept")
+	body, _ := ioutil.ReadAll(res.Body)
+	expect(t, string(body), "id,name\n1,report\n")
+
+	res = do("HEAD", "/reports/1", "", "text/csv")
+	expect(t, res.StatusCode, http.StatusOK)
+	expect(t, res.Header.Get("Content-Type"), "text/csv")
+
+	res = do("GET", "/reports/1", "", "application/pdf")
+	assert_Error_Response(t, res, http.StatusNotAcceptable)
+
+	res = do("POST", "/reports", "text/csv", "")
+	assert_Foo_Response(t, res, http.StatusCreated, Foo{"csv", 1})
+
+	res = do("POST", "/reports", "application/xml", "")
+	assert_Error_Response(t, res, http.StatusUnsupportedMediaType)
+
+	res = do("DELETE", "/reports", "application/xml", "")
+	assert_Error_Response(t, res, http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,40 @@
+package pastis
+
+import (
+	"net/http"
+	"strings"
+)
+
+//HEADER_Method_Override is the header telling the method a POST request overrides.
+const HEADER_Method_Override = "X-HTTP-Method-Override"
+
+//defaultOverridableMethods are the methods a POST request may override when no allowlist is given.
+var defaultOverridableMethods = []string{"PUT", "PATCH", "DELETE"}
+
+//overrideMethod returns the method a POST request asks to be routed to, either with the X-HTTP-Method-Override header
+//or with the _method form field, provided that the method is allowed. Otherwise the request method is returned.
+func overrideMethod(request *http.Request, allowed []string) string {
+	if request.Method != "POST" {
+		return request.Method
+	}
+	override := request.Header.Get(HEADER_Method_Override)
+	if override == "" {
+		override = request.PostForm.Get("_method")
+	}
+	override = strings.ToUpper(strings.TrimSpace(override))
+	for _, method := range allowed {
+		if method == override {
+			return override
+		}
+	}
+	return request.Method
+}
+
+//normalizeMethods returns the given methods upper-cased.
+func normalizeMethods(methods []string) []string {
+	normalized := make([]string, len(methods))
+	for i, method := range methods {
+		normalized[i] = strings.ToUpper(strings.TrimSpace(method))
+	}
+	return normalized
+}
@@ -0,0 +1,65 @@
+package pastis
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type OverriddenResource struct {
+}
+
+func (r OverriddenResource) Get() (int, interface{}) {
+	return http.StatusOK, Foo{"GET", 1}
+}
+
+func (r OverriddenResource) Post() (int, interface{}) {
+	return http.StatusCreated, Foo{"POST", 1}
+}
+
+func (r OverriddenResource) Put(params url.Values, foo Foo) (int, interface{}) {
+	return http.StatusOK, Foo{"PUT " + foo.Name, foo.Order}
+}
+
+func (r OverriddenResource) Delete() (int, interface{}) {
+	return http.StatusOK, Foo{"DELETE", 1}
+}
+
+func Test_Pastis_Method_Override(t *testing.T) {
+	p := NewAPI()
+	p.SetLevel("OFF")
+	p.AddResource("/foo", OverriddenResource{})
+	p.Patch("/foo", func() (int, interface{}) {
+		return http.StatusOK, Foo{"PATCH", 1}
+	})
+	p.HandleFunc()
+
+	serve := func(method string, override string, body string, contentType string) *http.Response {
+		request := httptest.NewRequest(method, "/foo", strings.NewReader(body))
+		if override != "" {
+			request.Header.Set(HEADER_Method_Override, override)
+		}
+		if contentType != "" {
+			request.Header.Set("Content-Type", contentType)
+		}
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, request)
+		return rw.Result()
+	}
+
+	//disabled by default
+	assert_Foo_Response(t, serve("POST", "DELETE", "", ""), http.StatusCreated, Foo{"POST", 1})
+
+	p.SetMethodOverride()
+	assert_Foo_Response(t, serve("POST", "delete", "", ""), http.StatusOK, Foo{"DELETE", 1})
+	assert_Foo_Response(t, serve("POST", "PUT", `{"Name":"bar","Order":2}`, "application/json"), http.StatusOK, Foo{"PUT bar", 2})
+	assert_Foo_Response(t, serve("POST", "", "_method=DELETE", "application/x-www-form-urlencoded"), http.StatusOK, Foo{"DELETE", 1})
+	assert_Foo_Response(t, serve("POST", "CONNECT", "", ""), http.StatusCreated, Foo{"POST", 1})
+	assert_Foo_Response(t, serve("GET", "DELETE", "", ""), http.StatusOK, Foo{"GET", 1})
+
+	p.SetMethodOverride("PUT", "DELETE")
+	assert_Foo_Response(t, serve("POST", "PATCH", "", ""), http.StatusCreated, Foo{"POST", 1})
+	assert_Foo_Response(t, serve("POST", "DELETE", "", ""), http.StatusOK, Foo{"DELETE", 1})
+}
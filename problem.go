@@ -0,0 +1,119 @@
+package pastis
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// MediaTypeProblem is the media type of the problem details responses.
+const MediaTypeProblem = "application/problem+json"
+
+// A Problem describes an error as a problem details object of RFC 7807. It is rendered as application/problem+json
+// for every error generated by pastis (unknown routes, disallowed methods, undecodable bodies, panics...), and callbacks
+// may either return it as response content or as an error.
+//
+// Extensions are members specific to the problem type, such as a machine-readable error code. They are rendered
+// along with the standard members.
+type Problem struct {
+	//URI reference identifying the problem type, about:blank by default
+	Type string
+	//Short summary of the problem type
+	Title string
+	//HTTP status code
+	Status int
+	//Explanation specific to this occurrence of the problem
+	Detail string
+	//URI reference identifying this occurrence of the problem
+	Instance string
+	//Additional members
+	Extensions map[string]interface{}
+}
+
+// NewProblem returns a problem of type about:blank, titled after the given status code.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// With sets an extension member of the problem and returns the problem.
+func (p *Problem) With(member string, value interface{}) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = make(map[string]interface{})
+	}
+	p.Extensions[member] = value
+	return p
+}
+
+// Error implements the error interface so that callbacks can return a problem as error.
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return fmt.Sprintf("%d %s", p.Status, p.Title)
+	}
+	return fmt.Sprintf("%d %s: %s", p.Status, p.Title, p.Detail)
+}
+
+// StatusCode implements HTTPError.
+func (p *Problem) StatusCode() int {
+	return p.Status
+}
+
+// PublicMessage implements HTTPError.
+func (p *Problem) PublicMessage() string {
+	return p.Detail
+}
+
+//problemMembers are the standard members of a problem details object.
+var problemMembers = []string{"type", "title", "status", "detail", "instance"}
+
+// MarshalJSON renders the standard members of the problem along with its extensions.
+// Empty standard members are omitted, and extensions never override them.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]interface{}, len(p.Extensions)+len(problemMembers))
+	for member, value := range p.Extensions {
+		members[member] = value
+	}
+	for i, value := range []interface{}{p.Type, p.Title, p.Status, p.Detail, p.Instance} {
+		delete(members, problemMembers[i])
+		if value != "" && value != 0 {
+			members[problemMembers[i]] = value
+		}
+	}
+	return json.Marshal(members)
+}
+
+// UnmarshalJSON reads a problem details object, the members other than the standard ones becoming extensions.
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	*p = Problem{}
+	for i, field := range []interface{}{&p.Type, &p.Title, &p.Status, &p.Detail, &p.Instance} {
+		if raw, ok := members[problemMembers[i]]; ok {
+			if err := json.Unmarshal(raw, field); err != nil {
+				return fmt.Errorf("problem member %s: %v", problemMembers[i], err)
+			}
+			delete(members, problemMembers[i])
+		}
+	}
+	for member, raw := range members {
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		p.With(member, value)
+	}
+	return nil
+}
+
+//writeProblem writes a problem as an application/problem+json response.
+func writeProblem(rw http.ResponseWriter, p *Problem) {
+	content, err := json.Marshal(p)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", MediaTypeProblem)
+	rw.WriteHeader(p.Status)
+	rw.Write(content)
+}
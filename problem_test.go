@@ -0,0 +1,76 @@
+package pastis
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func Test_Pastis_Problem_JSON(t *testing.T) {
+	problem := NewProblem(http.StatusForbidden, "not enough credit").With("code", "credit_exhausted").With("status", "ignored")
+	problem.Instance = "/accounts/12"
+	content, err := json.Marshal(problem)
+	expect(t, err, nil)
+	expect(t, string(content), `{"code":"credit_exhausted","detail":"not enough credit","instance":"/accounts/12","status":403,"title":"Forbidden","type":"about:blank"}`)
+
+	var decoded Problem
+	expect(t, json.Unmarshal(content, &decoded), nil)
+	expect(t, decoded.Status, http.StatusForbidden)
+	expect(t, decoded.Instance, "/accounts/12")
+	expect(t, len(decoded.Extensions), 1)
+	expect(t, decoded.Extensions["code"], "credit_exhausted")
+	refute(t, json.Unmarshal([]byte(`{"status":"403"}`), &decoded), nil)
+
+	content, _ = json.Marshal(Problem{Status: http.StatusNotFound})
+	expect(t, string(content), `{"status":404}`)
+}
+
+func Test_Pastis_Problem_Responses(t *testing.T) {
+	p := NewAPI()
+	p.Get("/content", func() (int, interface{}) {
+		return http.StatusConflict, NewProblem(http.StatusConflict, "version mismatch").With("code", "stale")
+	})
+	p.Get("/error", func() (Foo, error) {
+		return Foo{}, NewProblem(http.StatusPaymentRequired, "not enough credit").With("code", "credit_exhausted")
+	})
+	p.Get("/panic", func() (int, interface{}) {
+		panic("database password is wrong")
+	})
+	p.Get("/csv", func() (int, interface{}) {
+		return http.StatusGone, NewProblem(http.StatusGone, "report expired")
+	}, Produces("text/csv"))
+	p.Post("/foo", func(input Foo) (int, interface{}) {
+		return http.StatusOK, input
+	})
+	p.HandleFunc()
+
+	var problem Problem
+	rw := callbackRequest(p, "GET", "/content", "")
+	expect(t, rw.Code, http.StatusConflict)
+	expect(t, rw.Header().Get("Content-Type"), MediaTypeProblem)
+	json.Unmarshal(rw.Body.Bytes(), &problem)
+	expect(t, problem.Extensions["code"], "stale")
+
+	rw = callbackRequest(p, "GET", "/error", "")
+	expect(t, rw.Code, http.StatusPaymentRequired)
+	expect(t, rw.Header().Get("Content-Type"), MediaTypeProblem)
+	json.Unmarshal(rw.Body.Bytes(), &problem)
+	expect(t, problem.Extensions["code"], "credit_exhausted")
+
+	rw = callbackRequest(p, "GET", "/panic", "")
+	assert_Error_Response(t, rw.Result(), http.StatusInternalServerError)
+	expect(t, strings.Contains(rw.Body.String(), "password"), false)
+
+	rw = callbackRequest(p, "GET", "/csv", "")
+	expect(t, rw.Code, http.StatusGone)
+	expect(t, rw.Header().Get("Content-Type"), MediaTypeProblem)
+
+	rw = callbackRequest(p, "POST", "/foo", "{")
+	assert_Error_Response(t, rw.Result(), http.StatusBadRequest)
+
+	rw = callbackRequest(p, "GET", "/missing", "")
+	json.Unmarshal(rw.Body.Bytes(), &problem)
+	expect(t, problem.Instance, "/missing")
+	expect(t, problem.Type, "about:blank")
+}
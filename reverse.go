@@ -0,0 +1,97 @@
+package pastis
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+//patternParam matches the path parameters, optional or not, and the catch-alls of an URL-pattern.
+var patternParam = regexp.MustCompile(`:([^/#?()\.\\<>]+)(<[^>]+>)?(\?)?|\*\*|\*([^/#?()\.\\<>:*]+)$`)
+
+// URLFor builds the path of the route having the given name, substituting its path parameters with the given values.
+// Named catch-all values are read from their name while ** values are read from the _1, _2... keys as they are named when routing.
+// Optional parameters having no value are left out of the path, along with the rest of the pattern.
+// It returns an error when the route is unknown, when a parameter is missing or does not satisfy its constraint,
+// or when a parameter is given after an optional parameter having no value.
+func (router *Router) URLFor(name string, params url.Values) (string, error) {
+	rt := router.load()
+	r, ok := rt.names[name]
+	if !ok {
+		return "", fmt.Errorf("no route named %s", name)
+	}
+	pattern := r.pattern
+	if strings.ContainsAny(patternParam.ReplaceAllString(pattern, ""), regexpChars) {
+		return "", fmt.Errorf("route %s has a regular expression pattern %s", name, pattern)
+	}
+	var err error
+	var catchAlls int
+	var omitted string
+	path := patternParam.ReplaceAllStringFunc(pattern, func(token string) string {
+		if err != nil {
+			return ""
+		}
+		groups := patternParam.FindStringSubmatch(token)
+		if token == "**" || groups[4] != "" {
+			key := groups[4]
+			if key == "" {
+				catchAlls++
+				key = fmt.Sprintf("_%d", catchAlls)
+			}
+			if _, ok := params[key]; !ok {
+				err = fmt.Errorf("missing catch-all parameter %s for route %s", key, name)
+				return ""
+			}
+			if omitted != "" {
+				err = fmt.Errorf("catch-all parameter %s given after omitted optional parameter %s for route %s", key, omitted, name)
+				return ""
+			}
+			return escapePath(params.Get(key))
+		}
+		key, value := groups[1], params.Get(groups[1])
+		if value == "" && groups[3] != "" {
+			if omitted == "" {
+				omitted = key
+			}
+			return ""
+		}
+		if omitted != "" {
+			err = fmt.Errorf("parameter %s given after omitted optional parameter %s for route %s", key, omitted, name)
+			return ""
+		}
+		if value == "" {
+			err = fmt.Errorf("missing parameter %s for route %s", key, name)
+			return ""
+		}
+		if groups[2] != "" {
+			c, cerr := rt.constraint(groups[2][1 : len(groups[2])-1])
+			if cerr != nil {
+				err = fmt.Errorf("invalid parameter %s for route %s: %v", key, name, cerr)
+				return ""
+			}
+			if !c.regexp.MatchString(value) {
+				err = fmt.Errorf("invalid parameter %s=%q for route %s: expected %s", key, value, name, groups[2])
+				return ""
+			}
+		}
+		return url.PathEscape(value)
+	})
+	if err != nil {
+		return "", err
+	}
+	if omitted != "" {
+		//optional parameters end the pattern
+		path = rootPath(strings.TrimRight(path, "/"))
+	}
+	return path, nil
+}
+
+//escapePath escapes each segment of a path.
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
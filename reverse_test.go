@@ -0,0 +1,73 @@
+package pastis
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func Test_Pastis_URLFor(t *testing.T) {
+	router := NewRouter()
+	router.Add("/dashboards/:dashboardid/charts/:chartid<int>", "GET", nil, Name("chart"))
+	router.Add("/files/**", "GET", nil, Name("file"))
+	router.Add("^/comments/(?P<id>\\d+)$", "GET", nil, Name("comment"))
+	router.Add("/archives/:year<int>?/:month<int>?", "GET", nil, Name("archive"))
+	router.Add("/repos/:name/files/*path", "GET", nil, Name("repo-file"))
+
+	path, err := router.URLFor("chart", url.Values{"dashboardid": {"my dashboard"}, "chartid": {"2"}})
+	expect(t, err, nil)
+	expect(t, path, "/dashboards/my%20dashboard/charts/2")
+
+	path, err = router.URLFor("file", url.Values{"_1": {"css/main.css"}})
+	expect(t, err, nil)
+	expect(t, path, "/files/css/main.css")
+
+	path, err = router.URLFor("archive", url.Values{"year": {"2020"}})
+	expect(t, err, nil)
+	expect(t, path, "/archives/2020")
+	path, err = router.URLFor("archive", url.Values{})
+	expect(t, err, nil)
+	expect(t, path, "/archives")
+	_, err = router.URLFor("archive", url.Values{"month": {"12"}})
+	expect(t, err.Error(), "parameter month given after omitted optional parameter year for route archive")
+
+	path, err = router.URLFor("repo-file", url.Values{"name": {"acme/api"}, "path": {"docs/read me.md"}})
+	expect(t, err, nil)
+	expect(t, path, "/repos/acme%2Fapi/files/docs/read%20me.md")
+
+	_, err = router.URLFor("chart", url.Values{"dashboardid": {"1"}})
+	refute(t, err, nil)
+	_, err = router.URLFor("chart", url.Values{"dashboardid": {"1"}, "chartid": {"two"}})
+	refute(t, err, nil)
+	path, err = router.URLFor("chart", url.Values{"dashboardid": {"1/2"}, "chartid": {"2"}})
+	expect(t, err, nil)
+	expect(t, path, "/dashboards/1%2F2/charts/2")
+	_, err = router.URLFor("file", url.Values{})
+	refute(t, err, nil)
+	_, err = router.URLFor("comment", url.Values{"id": {"1"}})
+	refute(t, err, nil)
+	_, err = router.URLFor("unknown", url.Values{})
+	refute(t, err, nil)
+}
+
+func Test_Pastis_API_URLFor(t *testing.T) {
+	p := NewAPI()
+	v1 := p.Group("/v1")
+	v1.AddResource("/dashboards/:dashboardid", new(FooResource), Name("dashboard"))
+	p.HandleFunc()
+
+	path, err := p.URLFor("dashboard", url.Values{"dashboardid": {"1"}})
+	expect(t, err, nil)
+	expect(t, path, "/v1/dashboards/1")
+
+	ts := httptest.NewServer(p)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	assert_Foo_Response(t, res, http.StatusOK, Foo{"name", 1})
+}
@@ -1,61 +1,475 @@
 package pastis
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"net/url"
+	"path"
 	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 //Router is a struct consisting of a set of method paired with URL-matchin pattern where each pair is mapped to an handler function. 
+//Routes are compiled into a tree when they are added so that requests are routed without scanning every pattern.
+//
+//When several routes match a request, the route is chosen regardless of the order in which they were added:
+//going from the leftmost path segment to the rightmost, a literal segment beats a constrained parameter (in the order they were added),
+//which beats an unconstrained parameter, which beats a catch-all.
+//Patterns embedding regular expressions come last and are tried in the order they were added.
+//
+//Routes restricted to a host pattern are kept in separate tables. The tables of the host patterns matching the request host
+//are searched from the most specific pattern (a literal label beats a parameter, from the leftmost label), then in the order they
+//were added, before the table of the routes serving any host.
+//
+//Routes may be added and removed while requests are served: each request is routed with the routes
+//registered when it is received.
 type Router struct {
-	handlers map[string]map[string]http.HandlerFunc
+	//current routes, replaced as a whole when routes are added or removed
+	current atomic.Pointer[routing]
+	//serializes the route updates
+	mu sync.Mutex
+	//Strict makes Add panic instead of returning an error when a route conflicts with a route added previously
+	Strict bool
+	//Configurable handler called when no route matches the request path (404 Not Found by default)
+	NotFound http.HandlerFunc
+	//Configurable handler called when routes match the request path but none of them for the request method.
+	//The Allow header is already set when it is called (405 Method Not Allowed by default)
+	MethodNotAllowed http.HandlerFunc
+	//How request paths differing from the route patterns by their trailing slash, duplicate slashes or dot segments are handled
+	PathPolicy PathPolicy
+	//Configurable handler answering the OPTIONS requests on paths having no OPTIONS route.
+	//The Allow header is already set when it is called (204 No Content by default)
+	DefaultOptions http.HandlerFunc
+	//Methods a POST request may be routed to with the X-HTTP-Method-Override header or the _method form field.
+	//Method overriding is disabled when empty
+	MethodOverride []string
+	//Configurable handler called when routes match the request path and method but none of them produces
+	//a media type accepted by the request (406 Not Acceptable by default)
+	NotAcceptable http.HandlerFunc
+	//Configurable handler called when routes match the request path and method but none of them consumes
+	//the request content type (415 Unsupported Media Type by default)
+	UnsupportedMediaType http.HandlerFunc
 }
 
-//Prints out the routes in a friendly manner
+//Logs the routes in a friendly manner with the INFO level
 func (router *Router) OpsFriendlyLog(logger *Logger) {
-	fmt.Print("API Routes \n")
-	log := make(map[string][]string)
+	logger.Info("API Routes")
+	for _, r := range router.Routes() {
+		logger.Infof(" %s %s%s -> %s (%s)", r.Method, r.Host, r.Pattern, r.Handler, r.Source)
+	}
+}
 
-	for method, _ := range router.handlers {
-		for pattern, _ := range router.handlers[method] {
-			log[pattern] = []string{method}
-		}
+// NewRouter allocates and returns a new Router.
+func NewRouter() *Router {
+	constraints := make(map[string]*constraint)
+	for name, expr := range defaultConstraints {
+		constraints[name], _ = newConstraint(name, expr)
+	}
+	router := &Router{}
+	router.current.Store(&routing{table: table{root: &node{}}, constraints: constraints, names: make(map[string]*route)})
+	return router
+}
+
+//routing is a snapshot of the routes of a router.
+//A snapshot is never modified once published: routes are added to or removed from a copy of the current snapshot
+//which then replaces it, so that requests are routed without locking.
+type routing struct {
+	//routes serving any host
+	table
+	//routes restricted to a host pattern, in registration order
+	hosts []*hostTable
+	//constraints path parameters may refer to by name
+	constraints map[string]*constraint
+	//named routes
+	names map[string]*route
+}
+
+//load returns the current routes.
+func (router *Router) load() *routing {
+	return router.current.Load()
+}
+
+//update calls fn with a copy of the current routes and publishes the copy unless fn returns an error.
+func (router *Router) update(fn func(*routing) error) error {
+	router.mu.Lock()
+	defer router.mu.Unlock()
+	current := router.load()
+	next := &routing{table: current.copy(), hosts: append([]*hostTable(nil), current.hosts...), constraints: current.constraints,
+		names: make(map[string]*route, len(current.names))}
+	for name, r := range current.names {
+		next.names[name] = r
 	}
-	for pattern := range log {
-		for _, method := range log[pattern] {
-			fmt.Printf(" %v %s \n", method, pattern)
+	if err := fn(next); err != nil {
+		return err
+	}
+	router.current.Store(next)
+	return nil
+}
+
+//misplacedCatchAll matches the patterns having a named catch-all (*name) followed by other segments.
+var misplacedCatchAll = regexp.MustCompile(`(^|/)\*[^/#?()\.\\<>:*]+/`)
+
+// A PathPolicy tells how a router handles the request paths that differ from the route patterns
+// by their trailing slash, duplicate slashes or dot segments.
+// Patterns embedding regular expressions always match paths with or without a trailing slash.
+type PathPolicy int
+
+const (
+	// PathLenient routes the cleaned request path, with or without its trailing slash (default policy).
+	PathLenient PathPolicy = iota
+	// PathRedirect redirects the requests to the cleaned path having the trailing slash of the matching route.
+	PathRedirect
+	// PathStrict routes the request path as it is.
+	PathStrict
+)
+
+//cleanPath returns the canonical form of a path, without duplicate slashes nor dot segments.
+//The trailing slash is kept.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	cleaned := path.Clean(rootPath(p))
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		if len(p) == len(cleaned)+1 && strings.HasPrefix(p, cleaned) {
+			return p
 		}
+		return cleaned + "/"
 	}
+	return cleaned
 }
 
-// NewRouter allocates and returns a new Router.
-func NewRouter() *Router {
-	hs := make(map[string]map[string]http.HandlerFunc)
-	return &Router{hs}
+//toggleTrailingSlash adds a trailing slash to a path or removes it.
+func toggleTrailingSlash(path string) string {
+	if path == "/" {
+		return path
+	}
+	if strings.HasSuffix(path, "/") {
+		return path[:len(path)-1]
+	}
+	return path + "/"
+}
+
+// A RouteOption configures a route when it is added.
+type RouteOption func(*route)
+
+// Name gives a name to a route so that its URL can be built with URLFor.
+// The routes of a resource share the same name.
+func Name(name string) RouteOption {
+	return func(r *route) {
+		r.name = name
+	}
+}
+
+// Host restricts a route to the requests whose host matches the given pattern.
+// Host patterns are made of dot-separated labels which may be named parameters, as in :tenant.api.example.com.
+// Their values are passed to the callbacks along with the path parameters.
+func Host(pattern string) RouteOption {
+	return func(r *route) {
+		r.host = pattern
+	}
+}
+
+// Unfiltered makes the route skip the API and group filters.
+func Unfiltered() RouteOption {
+	return func(r *route) {
+		r.unfiltered = true
+	}
+}
+
+//mounted is the route option of the handlers mounted below a prefix.
+func mounted(r *route) {
+	r.mount = true
+}
+
+//isUnfiltered reports whether the given options make a route skip the filters.
+func isUnfiltered(options []RouteOption) bool {
+	r := &route{}
+	for _, option := range options {
+		option(r)
+	}
+	return r.unfiltered
 }
 
 // Add adds a route wichi consist of an URL-pattern matching, a method and an handler of type http.HandlerFunc
-func (router *Router) Add(pattern string, method string, handler http.HandlerFunc) {
-	if router.handlers[method] == nil {
-		router.handlers[method] = make(map[string]http.HandlerFunc)
+//
+// The route is not added when it cannot be distinguished from a route added previously: same method and pattern,
+// patterns differing only by their parameter names or name already given to another pattern.
+// Add then returns a *RouteConflictError, or panics with it when the router is strict.
+func (router *Router) Add(pattern string, method string, handler http.HandlerFunc, options ...RouteOption) error {
+	return router.addRoutes(newRoute(pattern, method, handler, options))
+}
+
+//newRoute returns the route of the given pattern, method and handler configured by the given options.
+func newRoute(pattern string, method string, handler http.HandlerFunc, options []RouteOption) *route {
+	r := &route{method: method, pattern: pattern, handler: handler, handlerName: funcName(handler), source: callerLocation()}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+//addRoutes adds all the given routes or, when one of them cannot be added, none of them.
+//It returns the error of the first route that cannot be added, or panics with it when the router is strict.
+func (router *Router) addRoutes(routes ...*route) error {
+	err := router.update(func(rt *routing) error {
+		for _, r := range routes {
+			if err := rt.add(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil && router.Strict {
+		panic(err)
 	}
-	router.handlers[method][pattern] = handler
+	return err
+}
+
+//add adds a route to the table of its host.
+func (rt *routing) add(r *route) error {
+	if existing := rt.names[r.name]; existing != nil && existing.pattern != r.pattern {
+		return &RouteConflictError{"reuses the name of", r.info(), existing.info()}
+	}
+	if err := rt.checkConstraints(r.pattern); err != nil {
+		return err
+	}
+	t := &rt.table
+	if r.host != "" {
+		var err error
+		if t, err = rt.hostTable(r.host); err != nil {
+			return err
+		}
+	}
+	var existing *route
+	if segments, names, ok := rt.parsePattern(r.pattern); ok {
+		r.params = names
+		//patterns having optional parameters are added once per path length
+		for _, variant := range variants(segments) {
+			if existing = t.add(r, variant); existing != nil {
+				break
+			}
+		}
+	} else if r.mount {
+		return fmt.Errorf("cannot mount an handler below the regular expression pattern %s", r.pattern)
+	} else if misplacedCatchAll.MatchString(r.pattern) {
+		return fmt.Errorf("named catch-all of pattern %s should be its last segment", r.pattern)
+	} else {
+		compiled, err := rt.compilePattern(r.pattern)
+		if err != nil {
+			return err
+		}
+		existing = t.addRegexp(r, compiled)
+	}
+	if existing != nil {
+		if existing.pattern == r.pattern {
+			return &RouteConflictError{"duplicates", r.info(), existing.info()}
+		}
+		return &RouteConflictError{"is ambiguous with", r.info(), existing.info()}
+	}
+	if r.name != "" {
+		rt.names[r.name] = r
+	}
+	return nil
+}
+
+// Remove removes the route added with the given URL-pattern and method. The Host, Consumes and Produces options
+// tell the host pattern and media types of the route; other options are ignored.
+// The requests already routed are still served by the removed route.
+// Remove returns an error when there is no such route.
+func (router *Router) Remove(pattern string, method string, options ...RouteOption) error {
+	r := &route{method: method, pattern: pattern}
+	for _, option := range options {
+		option(r)
+	}
+	return router.update(func(rt *routing) error {
+		return rt.remove(r)
+	})
+}
+
+// RemoveMount removes the handler mounted below the given prefix, whatever the method it was mounted for.
+// The Host option tells the host pattern of the mounted handler; other options are ignored.
+// RemoveMount returns an error when no handler is mounted below the prefix.
+func (router *Router) RemoveMount(prefix string, options ...RouteOption) error {
+	target := &route{pattern: joinPattern(prefix, "/**")}
+	for _, option := range options {
+		option(target)
+	}
+	return router.update(func(rt *routing) error {
+		var mounts []*route
+		rt.each(func(r *route) {
+			if r.mount && r.host == target.host && r.pattern == target.pattern {
+				mounts = append(mounts, r)
+			}
+		})
+		if len(mounts) == 0 {
+			return fmt.Errorf("no handler mounted below %s%s", target.host, prefix)
+		}
+		for _, r := range mounts {
+			if err := rt.remove(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//remove removes the route having the host pattern, method, URL-pattern and media types of target.
+func (rt *routing) remove(target *route) error {
+	t, i := &rt.table, -1
+	if target.host != "" {
+		if t, i = rt.findHostTable(target.host); t == nil {
+			return fmt.Errorf("no route %s %s%s", target.method, target.host, target.pattern)
+		}
+	}
+	var removed *route
+	if segments, _, ok := rt.parsePattern(target.pattern); ok {
+		for _, variant := range variants(segments) {
+			if r := t.remove(target, variant); r != nil {
+				removed = r
+			}
+		}
+	} else {
+		removed = t.removeRegexp(target)
+	}
+	if removed == nil {
+		return fmt.Errorf("no route %s %s%s", target.method, target.host, target.pattern)
+	}
+	if i >= 0 && t.empty() {
+		rt.hosts = append(rt.hosts[:i], rt.hosts[i+1:]...)
+	}
+	if removed.name != "" && rt.names[removed.name] == removed {
+		//the routes of a resource share their name
+		delete(rt.names, removed.name)
+		rt.each(func(r *route) {
+			if r.name == removed.name && rt.names[r.name] == nil {
+				rt.names[r.name] = r
+			}
+		})
+	}
+	return nil
+}
+
+// A RouteConflictError reports a route that cannot be distinguished from a route added previously.
+type RouteConflictError struct {
+	//how the routes conflict
+	Reason   string
+	Route    RouteInfo
+	Existing RouteInfo
+}
+
+func (e *RouteConflictError) Error() string {
+	return fmt.Sprintf("route %s %s%s added at %s %s route %s %s%s added at %s", e.Route.Method, e.Route.Host, e.Route.Pattern, e.Route.Source,
+		e.Reason, e.Existing.Method, e.Existing.Host, e.Existing.Pattern, e.Existing.Source)
+}
+
+//each calls fn once for every route, starting with the routes serving any host.
+func (rt *routing) each(fn func(*route)) {
+	//routes having optional parameters are found at several nodes
+	visited := make(map[*route]bool)
+	visit := func(r *route) {
+		if !visited[r] {
+			visited[r] = true
+			fn(r)
+		}
+	}
+	rt.table.each(visit)
+	for _, h := range rt.hosts {
+		h.each(visit)
+	}
+}
+
+//match returns the route matching the given host, method and path, along with its host and path parameters.
+//Among the routes differing by their media types, the route is chosen by the given negotiation, or is the first one added when it is nil.
+func (rt *routing) match(host string, method string, path string, n *negotiation) (*route, map[string]string) {
+	tables, hostParams := rt.tables(host)
+	for i, t := range tables {
+		if r, params := t.lookup(method, path, n); r != nil {
+			for key, value := range hostParams[i] {
+				params[key] = value
+			}
+			return r, params
+		}
+	}
+	return nil, nil
+}
+
+//unacceptable returns the status code answering a request whose path and method match routes that do not
+//consume its content type (415 Unsupported Media Type) or do not produce any accepted media type (406 Not Acceptable).
+//It returns 0 when no route matches the path and method of the request.
+func (rt *routing) unacceptable(host string, method string, path string, n *negotiation) int {
+	if r, _ := rt.match(host, method, path, nil); r == nil {
+		if method != "HEAD" {
+			return 0
+		}
+		if r, _ = rt.match(host, "GET", path, nil); r == nil {
+			return 0
+		}
+		method = "GET"
+	}
+	if r, _ := rt.match(host, method, path, &negotiation{contentType: n.contentType}); r != nil {
+		return http.StatusNotAcceptable
+	}
+	return http.StatusUnsupportedMediaType
+}
+
+//methods returns the set of methods of the routes matching the given host and path.
+func (rt *routing) methods(host string, path string) map[string]bool {
+	tables, _ := rt.tables(host)
+	methods := make(map[string]bool)
+	for _, t := range tables {
+		t.methods(path, methods)
+	}
+	return methods
+}
+
+//routable reports whether any route matches the given host and path.
+func (rt *routing) routable(host string, path string) bool {
+	return len(rt.methods(host, path)) > 0
+}
+
+//allowedMethods returns the sorted methods allowed on the given host and path,
+//that is the methods of the matching routes along with HEAD and OPTIONS which are answered by default.
+func (rt *routing) allowedMethods(host string, path string) []string {
+	methods := rt.methods(host, path)
+	if len(methods) == 0 {
+		return nil
+	}
+	delete(methods, AnyMethod)
+	//HEAD and OPTIONS are answered by default
+	if methods["GET"] {
+		methods["HEAD"] = true
+	}
+	methods["OPTIONS"] = true
+	return sortedMethods(methods)
 }
 
 //Regex simply builds a more reliable regex based on the initial pattern
 func Regexp(pattern string) *regexp.Regexp {
-	r := regexp.MustCompile(`:[^/#?()\.\\]+`)
-	pattern = r.ReplaceAllStringFunc(pattern, func(m string) string {
+	var catchAlls int
+	return regexp.MustCompile(expandParams(pattern, &catchAlls) + `\/?`)
+}
+
+//unconstrainedParam and catchAllParam match the parameters of a regular expression pattern.
+var (
+	unconstrainedParam = regexp.MustCompile(`:[^/#?()\.\\]+`)
+	catchAllParam      = regexp.MustCompile(`\*\*`)
+)
+
+//expandParams replaces the parameters and catch-alls of a part of a regular expression pattern with named groups.
+//The catch-alls are numbered from catchAlls, which counts those of the previous parts.
+func expandParams(pattern string, catchAlls *int) string {
+	pattern = unconstrainedParam.ReplaceAllStringFunc(pattern, func(m string) string {
 		return fmt.Sprintf(`(?P<%s>[^/#?]+)`, m[1:])
 	})
-	rr := regexp.MustCompile(`\*\*`)
-	var index int
-	pattern = rr.ReplaceAllStringFunc(pattern, func(m string) string {
-		index++
-		return fmt.Sprintf(`(?P<_%d>[^#?]*)`, index)
+	return catchAllParam.ReplaceAllStringFunc(pattern, func(m string) string {
+		*catchAlls++
+		return fmt.Sprintf(`(?P<_%d>[^#?]*)`, *catchAlls)
 	})
-	pattern += `\/?`
-	return regexp.MustCompile(pattern)
 }
 
 //Match checks whether the given pat matches the given regular expresion. 
@@ -84,17 +498,27 @@ func HandlerPath(pattern string) string {
 }
 
 //Handler returns an handler function of the API. 
-//This handler is built from the set of routes that have been
-//defined previously. 
+//This handler routes each request with the set of routes
+//defined when the request is received. 
 func (router *Router) Handler(logger *Logger) http.HandlerFunc {
 	return func(rw http.ResponseWriter, request *http.Request) {
 		logger.Debugf("routing [request=%v]...", request)
+		rt := router.load()
 
-		if request.ParseForm() != nil {
-			rw.WriteHeader(http.StatusBadRequest)
+		if err := request.ParseForm(); err != nil {
+			problem := NewProblem(http.StatusBadRequest, err.Error())
+			problem.Instance = request.URL.Path
+			writeProblem(rw, problem)
 			return
 		}
 
+		if len(router.MethodOverride) > 0 {
+			if override := overrideMethod(request, router.MethodOverride); override != request.Method {
+				logger.Debugf("Overriding method [%s] with [%s] ", request.Method, override)
+				request.Method = override
+			}
+		}
+
 		method := request.Method
 
 		if method == "OPTIONS" &&  request.Header.Get(HEADER_Access_Control_Request_Method) != "" {
@@ -102,20 +526,212 @@ func (router *Router) Handler(logger *Logger) http.HandlerFunc {
 			logger.Debugf("CORS negotiation initiaded: Routing to the Access control method [%v] ", method) 
 		}	
 
-		handlersForPattern := router.handlers[method]
+		path, escaped := routingPath(request.URL)
+		requested := path
+		if router.PathPolicy != PathStrict {
+			path = cleanPath(path)
+		}
+		neg := newNegotiation(request)
+		r, params := rt.match(request.Host, method, path, neg)
+		if r == nil && router.PathPolicy != PathStrict && !rt.routable(request.Host, path) {
+			if toggled := toggleTrailingSlash(path); rt.routable(request.Host, toggled) {
+				path = toggled
+				r, params = rt.match(request.Host, method, path, neg)
+			}
+		}
+		if router.PathPolicy == PathRedirect && path != requested {
+			logger.Debugf("Redirecting [url=%v] to its canonical path [%v] ", request.URL.Path, path)
+			redirect(rw, request, path, escaped)
+			return
+		}
 
-		for pattern := range handlersForPattern {
-			ok, params := Match(Regexp(pattern), request.URL.Path)
-			if ok {
-				logger.Debugf("Extracting params : URL [%s] | Pattern [%s] \n", request.URL.Path, pattern)
-				for key, _ := range params {
-					request.Form.Set(key, params[key])
-				}
-				handlersForPattern[pattern](rw, request)
+		if r != nil {
+			logger.Debugf("Extracting params : URL [%s] | Pattern [%s] \n", request.URL.Path, r.pattern)
+			serveRoute(r, params, escaped, neg, rw, request)
+			return
+		}
+		if method == "HEAD" {
+			if r, params := rt.match(request.Host, "GET", path, neg); r != nil {
+				logger.Debugf("Answering HEAD with the GET route : URL [%s] | Pattern [%s] \n", request.URL.Path, r.pattern)
+				head := &headResponseWriter{ResponseWriter: rw, code: http.StatusOK}
+				serveRoute(r, params, escaped, neg, head, request)
+				head.flush()
 				return
 			}
-		}	
+		}
+		switch rt.unacceptable(request.Host, method, path, neg) {
+		case http.StatusNotAcceptable:
+			logger.Debugf("No route produces an accepted media type for [method=%s,url=%v,accept=%v] ", method, request.URL.Path, request.Header.Get("Accept"))
+			serveDefault(router.NotAcceptable, http.StatusNotAcceptable, rw, request)
+			return
+		case http.StatusUnsupportedMediaType:
+			logger.Debugf("No route consumes [content-type=%s] for [method=%s,url=%v] ", neg.contentType, method, request.URL.Path)
+			serveDefault(router.UnsupportedMediaType, http.StatusUnsupportedMediaType, rw, request)
+			return
+		}
+		allowed := rt.allowedMethods(request.Host, path)
+		if len(allowed) == 0 {
+			logger.Debugf("No route found for [url=%v] ", request.URL.Path)
+			serveDefault(router.NotFound, http.StatusNotFound, rw, request)
+			return
+		}
+		rw.Header().Set("Allow", strings.Join(allowed, ", "))
+		if method == "OPTIONS" {
+			serveDefault(router.DefaultOptions, http.StatusNoContent, rw, request)
+			return
+		}
 		logger.Debugf("No handler found for [method=%s,url=%v] ", method, request.URL.Path)
-		rw.WriteHeader(http.StatusMethodNotAllowed)
+		serveDefault(router.MethodNotAllowed, http.StatusMethodNotAllowed, rw, request)
+	}
+}
+
+//redirect redirects the request to the given routing path, keeping its query. The path is escaped again, except for the
+//slashes and percent signs left encoded by routingPath when escaped is set.
+//GET and HEAD requests are permanently moved (301) while the other ones are permanently redirected (308) so that their method and body are preserved.
+func redirect(rw http.ResponseWriter, request *http.Request, path string, escaped bool) {
+	code := http.StatusPermanentRedirect
+	if request.Method == "GET" || request.Method == "HEAD" {
+		code = http.StatusMovedPermanently
+	}
+	path = escapeRoutingPath(path, escaped)
+	if request.URL.RawQuery != "" {
+		path += "?" + request.URL.RawQuery
+	}
+	http.Redirect(rw, request, path, code)
+}
+
+//routingPath returns the path a request is routed with, and whether it keeps percent-encoded slashes.
+//Encoded slashes are part of a path segment rather than separators: when the request path has some,
+//the path is decoded except for its encoded slashes and percent signs, which are decoded in the path parameter values.
+func routingPath(u *url.URL) (string, bool) {
+	if u.RawPath == "" || !strings.Contains(strings.ToUpper(u.RawPath), "%2F") {
+		return u.Path, false
+	}
+	raw := u.RawPath
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '%' && i+2 < len(raw) {
+			code := strings.ToUpper(raw[i+1 : i+3])
+			if code == "2F" || code == "25" {
+				b.WriteString("%" + code)
+				i += 2
+				continue
+			}
+			if c, err := strconv.ParseUint(code, 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(raw[i])
+	}
+	return b.String(), true
+}
+
+//escapeRoutingPath returns the escaped form of a routing path. When escaped is set, the path percent signs only start
+//the %2F and %25 sequences left encoded by routingPath, which are kept as they are.
+func escapeRoutingPath(path string, escaped bool) string {
+	if !escaped {
+		return (&url.URL{Path: path}).EscapedPath()
+	}
+	parts := strings.Split(path, "%")
+	for i, part := range parts {
+		if i == 0 {
+			parts[i] = (&url.URL{Path: part}).EscapedPath()
+			continue
+		}
+		parts[i] = part[:2] + (&url.URL{Path: part[2:]}).EscapedPath()
+	}
+	return strings.Join(parts, "%")
+}
+
+//unescapeSegment decodes the slashes and percent signs left encoded by routingPath.
+var unescapeSegment = strings.NewReplacer("%2F", "/", "%25", "%")
+
+//serveRoute calls the route handler once the path parameters are added to the request form and its path values.
+//Handlers mounted below a prefix are given the request with the path that follows the prefix.
+//The response Content-Type is set to the negotiated media type when the route declares the media types it produces.
+func serveRoute(r *route, params map[string]string, escaped bool, n *negotiation, rw http.ResponseWriter, request *http.Request) {
+	if len(r.produces) > 0 {
+		mediaType, _, _ := r.negotiate(n.accept)
+		rw.Header().Set("Content-Type", mediaType)
+		rw.Header().Add("Vary", "Accept")
+	}
+	var rest string
+	if r.mount {
+		rest = r.params[len(r.params)-1]
+	}
+	for key, value := range params {
+		if escaped {
+			value = unescapeSegment.Replace(value)
+		}
+		if key != rest {
+			request.Form.Set(key, value)
+			request.SetPathValue(key, value)
+		}
+	}
+	if r.mount {
+		request = stripPrefix(request, "/"+params[rest], escaped)
+	}
+	r.handler(rw, request)
+}
+
+//mountedPathKey is the context key of the request path as it was before the mount prefix was stripped.
+type mountedPathKey struct{}
+
+//stripPrefix returns a shallow copy of the request having the given path, which keeps its encoded slashes when escaped.
+//The path before stripping remains available through mountedPath.
+func stripPrefix(request *http.Request, path string, escaped bool) *http.Request {
+	stripped := request.WithContext(context.WithValue(request.Context(), mountedPathKey{}, request.URL.Path))
+	stripped.URL = new(url.URL)
+	*stripped.URL = *request.URL
+	stripped.URL.Path = path
+	stripped.URL.RawPath = ""
+	if escaped {
+		stripped.URL.Path = unescapeSegment.Replace(path)
+		stripped.URL.RawPath = path
+	}
+	return stripped
+}
+
+//mountedPath returns the path of a request given to a mounted handler as it was before the mount prefix was stripped.
+func mountedPath(request *http.Request) string {
+	if path, ok := request.Context().Value(mountedPathKey{}).(string); ok {
+		return path
+	}
+	return request.URL.Path
+}
+
+//serveDefault calls the given default handler or simply writes the status code when there is none.
+func serveDefault(handler http.HandlerFunc, code int, rw http.ResponseWriter, request *http.Request) {
+	if handler != nil {
+		handler(rw, request)
+		return
+	}
+	rw.WriteHeader(code)
+}
+
+//headResponseWriter answers a HEAD request with the response of a GET route, without its body.
+//The status code is held back until the handler returns so that the Content-Length header matches the discarded body.
+type headResponseWriter struct {
+	http.ResponseWriter
+	code   int
+	length int
+}
+
+func (w *headResponseWriter) WriteHeader(code int) {
+	w.code = code
+}
+
+func (w *headResponseWriter) Write(b []byte) (int, error) {
+	w.length += len(b)
+	return len(b), nil
+}
+
+//flush writes the held back status code.
+func (w *headResponseWriter) flush() {
+	if w.Header().Get("Content-Length") == "" && w.length > 0 {
+		w.Header().Set("Content-Length", strconv.Itoa(w.length))
 	}
+	w.ResponseWriter.WriteHeader(w.code)
 }
@@ -1,6 +1,11 @@
 package pastis
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -35,3 +40,551 @@ func Test_Pastis_ComplexRegexpMatch(t *testing.T) {
 	expect(t, params["dashboardid"], "1")
 }
 
+func Test_Pastis_Router_Lookup(t *testing.T) {
+	router := NewRouter()
+	router.Add("/", "GET", nil)
+	router.Add("/dashboards/:dashboardid", "GET", nil)
+	router.Add("/dashboards/:dashboardid/charts/:chartid", "GET", nil)
+	router.Add("/files/**", "GET", nil)
+	router.Add("^/comment/(?P<id>\\d+)$", "GET", nil)
+
+	r, params := router.load().lookup("GET", "/", nil)
+	expect(t, r.pattern, "/")
+
+	r, params = router.load().lookup("GET", "/dashboards/1/charts/2", nil)
+	expect(t, r.pattern, "/dashboards/:dashboardid/charts/:chartid")
+	expect(t, params["dashboardid"], "1")
+	expect(t, params["chartid"], "2")
+
+	r, params = router.load().lookup("GET", "/files/css/main.css", nil)
+	expect(t, r.pattern, "/files/**")
+	expect(t, params["_1"], "css/main.css")
+
+	r, params = router.load().lookup("GET", "/comment/123", nil)
+	expect(t, r.pattern, "^/comment/(?P<id>\\d+)$")
+	expect(t, params["id"], "123")
+
+	r, _ = router.load().lookup("GET", "/dashboards/1/unknown", nil)
+	expect(t, r == nil, true)
+	r, _ = router.load().lookup("POST", "/dashboards/1", nil)
+	expect(t, r == nil, true)
+}
+
+//benchmarkRoutes returns a few hundred routes along with a path matching the last one.
+func benchmarkRoutes() ([]string, string) {
+	var patterns []string
+	for i := 0; i < 100; i++ {
+		patterns = append(patterns,
+			fmt.Sprintf("/resource%d", i),
+			fmt.Sprintf("/resource%d/:id", i),
+			fmt.Sprintf("/resource%d/:id/items/:itemid", i))
+	}
+	return patterns, "/resource99/1234/items/5678"
+}
+
+func Benchmark_Pastis_Regexp_Routing(b *testing.B) {
+	patterns, path := benchmarkRoutes()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, pattern := range patterns {
+			if ok, _ := Match(Regexp(pattern), path); ok {
+				break
+			}
+		}
+	}
+}
+
+func Benchmark_Pastis_Precompiled_Regexp_Routing(b *testing.B) {
+	patterns, path := benchmarkRoutes()
+	regexps := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		regexps[i] = Regexp(pattern)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, r := range regexps {
+			if ok, _ := Match(r, path); ok {
+				break
+			}
+		}
+	}
+}
+
+func Benchmark_Pastis_Tree_Routing(b *testing.B) {
+	patterns, path := benchmarkRoutes()
+	router := NewRouter()
+	for _, pattern := range patterns {
+		router.Add(pattern, "GET", nil)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if r, _ := router.load().lookup("GET", path, nil); r == nil {
+			b.Fatal("no route found")
+		}
+	}
+}
+
+//permutations returns every ordering of the given patterns.
+func permutations(patterns []string) [][]string {
+	if len(patterns) <= 1 {
+		return [][]string{patterns}
+	}
+	var result [][]string
+	for i := range patterns {
+		rest := make([]string, 0, len(patterns)-1)
+		rest = append(rest, patterns[:i]...)
+		rest = append(rest, patterns[i+1:]...)
+		for _, p := range permutations(rest) {
+			result = append(result, append([]string{patterns[i]}, p...))
+		}
+	}
+	return result
+}
+
+func Test_Pastis_Router_Precedence(t *testing.T) {
+	patterns := []string{
+		"/dashboards/new",
+		"/dashboards/:dashboardid",
+		"/dashboards/**",
+		"/dashboards/:dashboardid/charts",
+		"/dashboards/new/charts/:chartid",
+		"/dashboards/:dashboardid/charts/new",
+		"/dashboards/:dashboardid/**",
+	}
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{"/dashboards/new", "/dashboards/new"},
+		{"/dashboards/new/", "/dashboards/:dashboardid/**"},
+		{"/dashboards/1", "/dashboards/:dashboardid"},
+		{"/dashboards/", "/dashboards/**"},
+		{"/dashboards/1/2", "/dashboards/:dashboardid/**"},
+		{"/dashboards/new/2", "/dashboards/:dashboardid/**"},
+		{"/dashboards/new/charts", "/dashboards/:dashboardid/charts"},
+		{"/dashboards/new/charts/new", "/dashboards/new/charts/:chartid"},
+		{"/dashboards/1/charts/new", "/dashboards/:dashboardid/charts/new"},
+		{"/dashboards/1/charts/2", "/dashboards/:dashboardid/**"},
+	}
+	for _, order := range permutations(patterns) {
+		router := NewRouter()
+		for _, pattern := range order {
+			router.Add(pattern, "GET", nil)
+		}
+		for _, c := range cases {
+			r, _ := router.load().lookup("GET", c.path, nil)
+			if r == nil || r.pattern != c.expected {
+				t.Fatalf("%s routed to %v instead of %s with routes added in order %v", c.path, r, c.expected, order)
+			}
+		}
+	}
+}
+
+func Test_Pastis_Router_Precedence_Per_Method(t *testing.T) {
+	router := NewRouter()
+	router.Add("/dashboards/new", "GET", nil)
+	router.Add("/dashboards/:dashboardid", "DELETE", nil)
+	router.Add("/dashboards/**", "PUT", nil)
+
+	r, _ := router.load().lookup("GET", "/dashboards/new", nil)
+	expect(t, r.pattern, "/dashboards/new")
+	r, params := router.load().lookup("DELETE", "/dashboards/new", nil)
+	expect(t, r.pattern, "/dashboards/:dashboardid")
+	expect(t, params["dashboardid"], "new")
+	r, _ = router.load().lookup("PUT", "/dashboards/new", nil)
+	expect(t, r.pattern, "/dashboards/**")
+}
+
+func Test_Pastis_Router_Regexp_Precedence(t *testing.T) {
+	router := NewRouter()
+	router.Add("^/comments/(?P<id>\\d+)$", "GET", nil)
+	router.Add("^/comments/(?P<slug>[a-z0-9]+)$", "GET", nil)
+	router.Add("/comments/:name", "POST", nil)
+
+	r, params := router.load().lookup("GET", "/comments/123", nil)
+	expect(t, r.pattern, "^/comments/(?P<id>\\d+)$")
+	expect(t, params["id"], "123")
+	r, params = router.load().lookup("GET", "/comments/abc", nil)
+	expect(t, r.pattern, "^/comments/(?P<slug>[a-z0-9]+)$")
+	expect(t, params["slug"], "abc")
+
+	router.Add("/comments/:name", "GET", nil)
+	r, params = router.load().lookup("GET", "/comments/123", nil)
+	expect(t, r.pattern, "/comments/:name")
+	expect(t, params["name"], "123")
+}
+
+func Test_Pastis_Router_Walk_Order(t *testing.T) {
+	router := NewRouter()
+	router.Add("^/comments/(?P<id>\\d+)$", "GET", nil)
+	router.Add("/dashboards/**", "GET", nil)
+	router.Add("/dashboards/:dashboardid", "PUT", nil)
+	router.Add("/dashboards/:dashboardid", "GET", nil)
+	router.Add("/dashboards/new", "GET", nil)
+
+	var visited []string
+	router.load().each(func(r *route) {
+		visited = append(visited, r.method+" "+r.pattern)
+	})
+	expect(t, fmt.Sprint(visited), fmt.Sprint([]string{
+		"GET /dashboards/new",
+		"GET /dashboards/:dashboardid",
+		"PUT /dashboards/:dashboardid",
+		"GET /dashboards/**",
+		"GET ^/comments/(?P<id>\\d+)$",
+	}))
+}
+
+func Test_Pastis_Router_Allowed_Methods(t *testing.T) {
+	router := NewRouter()
+	router.Add("/dashboards/new", "GET", nil)
+	router.Add("/dashboards/:dashboardid", "PUT", nil)
+	router.Add("/dashboards/:dashboardid", "DELETE", nil)
+	router.Add("/dashboards/**", "POST", nil)
+	router.Add("^/charts/(?P<id>\\d+)$", "PATCH", nil)
+
+	expect(t, fmt.Sprint(sortedMethods(router.load().methods("", "/dashboards/new"))), "[DELETE GET POST PUT]")
+	expect(t, fmt.Sprint(sortedMethods(router.load().methods("", "/dashboards/1"))), "[DELETE POST PUT]")
+	expect(t, fmt.Sprint(sortedMethods(router.load().methods("", "/dashboards/1/charts"))), "[POST]")
+	expect(t, fmt.Sprint(sortedMethods(router.load().methods("", "/charts/1"))), "[PATCH]")
+	expect(t, len(sortedMethods(router.load().methods("", "/charts/new"))), 0)
+	expect(t, len(sortedMethods(router.load().methods("", "/unknown"))), 0)
+}
+
+func Test_Pastis_Router_Constraints(t *testing.T) {
+	router := NewRouter()
+	router.Add("/charts/:name", "GET", nil)
+	router.Add("/charts/:id<int>", "GET", nil)
+	router.Add("/users/:uuid<uuid>", "GET", nil)
+	router.Add("/files/:slug<[a-z0-9-]+>", "GET", nil)
+	router.Add("^/comments/:id<int>/(?P<page>\\d+)$", "GET", nil)
+
+	r, params := router.load().lookup("GET", "/charts/12", nil)
+	expect(t, r.pattern, "/charts/:id<int>")
+	expect(t, params["id"], "12")
+
+	r, params = router.load().lookup("GET", "/charts/twelve", nil)
+	expect(t, r.pattern, "/charts/:name")
+	expect(t, params["name"], "twelve")
+
+	r, params = router.load().lookup("GET", "/users/0b6a1f2e-9c4d-4f5e-8a7b-1c2d3e4f5a6b", nil)
+	expect(t, r.pattern, "/users/:uuid<uuid>")
+	expect(t, params["uuid"], "0b6a1f2e-9c4d-4f5e-8a7b-1c2d3e4f5a6b")
+	r, _ = router.load().lookup("GET", "/users/42", nil)
+	expect(t, r == nil, true)
+
+	r, params = router.load().lookup("GET", "/files/my-file-2", nil)
+	expect(t, r.pattern, "/files/:slug<[a-z0-9-]+>")
+	expect(t, params["slug"], "my-file-2")
+	r, _ = router.load().lookup("GET", "/files/My_File", nil)
+	expect(t, r == nil, true)
+
+	r, params = router.load().lookup("GET", "/comments/7/2", nil)
+	expect(t, r.pattern, "^/comments/:id<int>/(?P<page>\\d+)$")
+	expect(t, params["id"], "7")
+	expect(t, params["page"], "2")
+	r, _ = router.load().lookup("GET", "/comments/seven/2", nil)
+	expect(t, r == nil, true)
+
+	//constrained parameters next to a literal suffix are routed through a regular expression
+	expect(t, router.Add("/drafts/:id<(?:draft)>.json", "GET", nil), nil)
+	expect(t, router.Add("/reports/:id<int>.csv", "GET", nil), nil)
+	refute(t, router.Add("/broken/:id<int>(.csv", "GET", nil), nil)
+	r, params = router.load().lookup("GET", "/drafts/draft.json", nil)
+	expect(t, r.pattern, "/drafts/:id<(?:draft)>.json")
+	expect(t, params["id"], "draft")
+	r, _ = router.load().lookup("GET", "/drafts/final.json", nil)
+	expect(t, r == nil, true)
+	r, params = router.load().lookup("GET", "/reports/42.csv", nil)
+	expect(t, r.pattern, "/reports/:id<int>.csv")
+	expect(t, params["id"], "42")
+	r, _ = router.load().lookup("GET", "/reports/x.csv", nil)
+	expect(t, r == nil, true)
+}
+
+func Test_Pastis_Router_Custom_Constraint(t *testing.T) {
+	router := NewRouter()
+	refute(t, router.AddConstraint("broken", "[a-"), nil)
+	expect(t, router.AddConstraint("color", "red|green|blue"), nil)
+	router.Add("/colors/:color<color>", "GET", nil)
+	router.Add("/colors/:other", "GET", nil)
+
+	r, _ := router.load().lookup("GET", "/colors/green", nil)
+	expect(t, r.pattern, "/colors/:color<color>")
+	r, _ = router.load().lookup("GET", "/colors/greenish", nil)
+	expect(t, r.pattern, "/colors/:other")
+
+	refute(t, router.Add("/items/:id<itn>", "GET", nil), nil)
+	refute(t, router.Add("^/items/:id<itn>/(?P<page>\\d+)$", "GET", nil), nil)
+	refute(t, router.Add("/items/:id<[0-9>", "GET", nil), nil)
+	expect(t, router.Add("/items/:id<(?:itn)>", "GET", nil), nil)
+	r, _ = router.load().lookup("GET", "/items/itn", nil)
+	expect(t, r.pattern, "/items/:id<(?:itn)>")
+}
+
+func routerTestHandler(rw http.ResponseWriter, request *http.Request) {
+}
+
+func Test_Pastis_Router_Routes(t *testing.T) {
+	router := NewRouter()
+	router.Add("/foo", "PUT", routerTestHandler)
+	router.Add("/foo", "GET", routerTestHandler, Name("foo"))
+	router.Add("/bar", "GET", routerTestHandler, Host("admin.example.com"))
+	router.Add("^/comments/(?P<id>\\d+)$", "GET", routerTestHandler)
+
+	routes := router.Routes()
+	expect(t, len(routes), 4)
+	expect(t, routes[0].Pattern, "/foo")
+	expect(t, routes[0].Method, "GET")
+	expect(t, routes[0].Name, "foo")
+	expect(t, routes[1].Pattern, "/foo")
+	expect(t, routes[1].Method, "PUT")
+	expect(t, routes[2].Pattern, "^/comments/(?P<id>\\d+)$")
+	expect(t, routes[3].Host, "admin.example.com")
+	expect(t, routes[3].Handler, funcName(routerTestHandler))
+	expect(t, strings.HasSuffix(routes[3].Handler, ".routerTestHandler"), true)
+	expect(t, strings.Contains(routes[3].Source, "router_test.go:"), true)
+}
+
+func Test_Pastis_Router_Conflicts(t *testing.T) {
+	router := NewRouter()
+	expect(t, router.Add("/a/:x", "GET", routerTestHandler, Name("a")), nil)
+	expect(t, router.Add("/a/:x", "PUT", routerTestHandler, Name("a")), nil)
+	expect(t, router.Add("/a/:x<int>", "GET", routerTestHandler), nil)
+	expect(t, router.Add("/a/b", "GET", routerTestHandler), nil)
+	expect(t, router.Add("/a/:x", "GET", routerTestHandler, Host("example.com")), nil)
+	expect(t, router.Add("^/c/(?P<id>\\d+)$", "GET", routerTestHandler), nil)
+
+	err := router.Add("/a/:x", "GET", routerTestHandler)
+	conflict, ok := err.(*RouteConflictError)
+	expect(t, ok, true)
+	expect(t, conflict.Reason, "duplicates")
+	expect(t, conflict.Existing.Pattern, "/a/:x")
+	expect(t, strings.Contains(conflict.Route.Source, "router_test.go:"), true)
+	expect(t, strings.Contains(conflict.Existing.Source, "router_test.go:"), true)
+	expect(t, strings.Contains(err.Error(), conflict.Existing.Source), true)
+
+	err = router.Add("/a/:y", "GET", routerTestHandler)
+	conflict = err.(*RouteConflictError)
+	expect(t, conflict.Reason, "is ambiguous with")
+	expect(t, conflict.Route.Pattern, "/a/:y")
+	expect(t, conflict.Existing.Pattern, "/a/:x")
+
+	err = router.Add("/a/:y<int>", "GET", routerTestHandler)
+	expect(t, err.(*RouteConflictError).Existing.Pattern, "/a/:x<int>")
+
+	err = router.Add("^/c/(?P<id>\\d+)$", "GET", routerTestHandler)
+	expect(t, err.(*RouteConflictError).Reason, "duplicates")
+
+	err = router.Add("/d", "GET", routerTestHandler, Name("a"))
+	expect(t, err.(*RouteConflictError).Reason, "reuses the name of")
+
+	r, params := router.load().lookup("GET", "/a/1", nil)
+	expect(t, r.pattern, "/a/:x<int>")
+	expect(t, params["x"], "1")
+	r, _ = router.load().lookup("GET", "/d", nil)
+	expect(t, r == nil, true)
+	expect(t, len(router.Routes()), 6)
+}
+
+func Test_Pastis_Router_Strict(t *testing.T) {
+	router := NewRouter()
+	router.Strict = true
+	router.Add("/a/:x", "GET", routerTestHandler)
+	defer func() {
+		_, ok := recover().(*RouteConflictError)
+		expect(t, ok, true)
+	}()
+	router.Add("/a/:y", "GET", routerTestHandler)
+	t.Error("strict router did not panic")
+}
+
+func Test_Pastis_Clean_Path(t *testing.T) {
+	expect(t, cleanPath(""), "/")
+	expect(t, cleanPath("/"), "/")
+	expect(t, cleanPath("/foo/"), "/foo/")
+	expect(t, cleanPath("//foo//bar"), "/foo/bar")
+	expect(t, cleanPath("/foo/../bar/./baz/"), "/bar/baz/")
+	expect(t, cleanPath("foo/.."), "/")
+	expect(t, toggleTrailingSlash("/foo"), "/foo/")
+	expect(t, toggleTrailingSlash("/foo/"), "/foo")
+	expect(t, toggleTrailingSlash("/"), "/")
+}
+
+func Test_Pastis_Router_Path_Policies(t *testing.T) {
+	router := NewRouter()
+	router.Add("/foo", "GET", routerTestHandler)
+	router.Add("/foo", "POST", routerTestHandler)
+	router.Add("/bar/", "GET", routerTestHandler)
+	router.Add("/docs/:name", "GET", routerTestHandler)
+	logger := GetLogger("OFF")
+
+	serve := func(policy PathPolicy, method string, target string) *httptest.ResponseRecorder {
+		router.PathPolicy = policy
+		rw := httptest.NewRecorder()
+		router.Handler(logger)(rw, httptest.NewRequest(method, target, nil))
+		return rw
+	}
+
+	cases := []struct {
+		policy   PathPolicy
+		method   string
+		target   string
+		code     int
+		location string
+	}{
+		{PathLenient, "GET", "/foo", http.StatusOK, ""},
+		{PathLenient, "GET", "/foo/", http.StatusOK, ""},
+		{PathLenient, "GET", "//foo", http.StatusOK, ""},
+		{PathLenient, "GET", "/bar/../foo/", http.StatusOK, ""},
+		{PathLenient, "GET", "/bar", http.StatusOK, ""},
+		{PathRedirect, "GET", "/foo", http.StatusOK, ""},
+		{PathRedirect, "GET", "/foo/?q=1", http.StatusMovedPermanently, "/foo?q=1"},
+		{PathRedirect, "HEAD", "//foo", http.StatusMovedPermanently, "/foo"},
+		{PathRedirect, "POST", "/foo/", http.StatusPermanentRedirect, "/foo"},
+		{PathRedirect, "GET", "/bar", http.StatusMovedPermanently, "/bar/"},
+		{PathRedirect, "GET", "/unknown/", http.StatusNotFound, ""},
+		{PathRedirect, "GET", "/docs//a%3Fb", http.StatusMovedPermanently, "/docs/a%3Fb"},
+		{PathRedirect, "GET", "/docs//a%20b%C3%A9?q=1", http.StatusMovedPermanently, "/docs/a%20b%C3%A9?q=1"},
+		{PathRedirect, "GET", "/docs//a%2Fb%3F%20c", http.StatusMovedPermanently, "/docs/a%2Fb%3F%20c"},
+		{PathRedirect, "GET", "/docs/a%3Fb", http.StatusOK, ""},
+		{PathStrict, "GET", "/foo", http.StatusOK, ""},
+		{PathStrict, "GET", "/foo/", http.StatusNotFound, ""},
+		{PathStrict, "GET", "//foo", http.StatusNotFound, ""},
+		{PathStrict, "GET", "/bar", http.StatusNotFound, ""},
+		{PathStrict, "GET", "/bar/", http.StatusOK, ""},
+	}
+	for _, c := range cases {
+		rw := serve(c.policy, c.method, c.target)
+		if rw.Code != c.code || rw.Header().Get("Location") != c.location {
+			t.Errorf("%s %s with policy %d answered %d %q instead of %d %q", c.method, c.target, c.policy, rw.Code, rw.Header().Get("Location"), c.code, c.location)
+		}
+	}
+}
+
+func Test_Pastis_Router_Remove(t *testing.T) {
+	router := NewRouter()
+	router.Add("/dashboards/:dashboardid", "GET", routerTestHandler, Name("dashboard"))
+	router.Add("/dashboards/:dashboardid", "DELETE", routerTestHandler, Name("dashboard"))
+	router.Add("/dashboards/:dashboardid/charts/:chartid<int>", "GET", routerTestHandler)
+	router.Add("^/comments/(?P<id>\\d+)$", "GET", routerTestHandler)
+	router.Add("/dashboards", "GET", routerTestHandler, Host(":tenant.example.com"))
+	before := router.load()
+
+	expect(t, router.Remove("/dashboards/:dashboardid/charts/:chartid<int>", "GET"), nil)
+	r, _ := router.load().lookup("GET", "/dashboards/1/charts/2", nil)
+	expect(t, r == nil, true)
+	expect(t, len(router.load().root.static["dashboards"].params[0].params), 0)
+	r, _ = before.lookup("GET", "/dashboards/1/charts/2", nil)
+	expect(t, r != nil, true)
+
+	expect(t, router.Remove("/dashboards/:dashboardid", "GET"), nil)
+	url, err := router.URLFor("dashboard", map[string][]string{"dashboardid": {"1"}})
+	expect(t, err, nil)
+	expect(t, url, "/dashboards/1")
+	expect(t, router.Remove("/dashboards/:dashboardid", "DELETE"), nil)
+	_, err = router.URLFor("dashboard", map[string][]string{"dashboardid": {"1"}})
+	refute(t, err, nil)
+	expect(t, router.load().root.empty(), true)
+
+	expect(t, router.Remove("^/comments/(?P<id>\\d+)$", "GET"), nil)
+	expect(t, len(router.load().regexps), 0)
+
+	refute(t, router.Remove("/dashboards", "GET"), nil)
+	expect(t, router.Remove("/dashboards", "GET", Host(":tenant.example.com")), nil)
+	expect(t, len(router.load().hosts), 0)
+
+	refute(t, router.Remove("/dashboards/:id", "GET"), nil)
+	var count int
+	before.each(func(*route) { count++ })
+	expect(t, count, 5)
+	expect(t, len(router.Routes()), 0)
+}
+
+func Test_Pastis_Router_Remove_Keeps_Precedence(t *testing.T) {
+	router := NewRouter()
+	router.Add("/items/:id<int>", "GET", routerTestHandler)
+	router.Add("/items/:slug<[a-z]+>", "GET", routerTestHandler)
+	router.Add("/items/:name", "GET", routerTestHandler)
+	expect(t, router.Remove("/items/:id<int>", "GET"), nil)
+	router.Add("/items/:id<int>", "GET", routerTestHandler)
+
+	r, _ := router.load().lookup("GET", "/items/abc", nil)
+	expect(t, r.pattern, "/items/:slug<[a-z]+>")
+	r, _ = router.load().lookup("GET", "/items/12", nil)
+	expect(t, r.pattern, "/items/:id<int>")
+	r, _ = router.load().lookup("GET", "/items/A-1", nil)
+	expect(t, r.pattern, "/items/:name")
+}
+
+func Test_Pastis_Router_Named_Catch_All(t *testing.T) {
+	router := NewRouter()
+	router.Add("/files/*path", "GET", routerTestHandler)
+	router.Add("/files/readme", "GET", routerTestHandler)
+	expect(t, router.Add("/files/*other", "GET", routerTestHandler) != nil, true)
+	refute(t, router.Add("/archives/*path/raw", "GET", routerTestHandler), nil)
+
+	r, params := router.load().lookup("GET", "/files/css/main.css", nil)
+	expect(t, r.pattern, "/files/*path")
+	expect(t, params["path"], "css/main.css")
+	r, params = router.load().lookup("GET", "/files/", nil)
+	expect(t, r.pattern, "/files/*path")
+	expect(t, params["path"], "")
+	r, _ = router.load().lookup("GET", "/files/readme", nil)
+	expect(t, r.pattern, "/files/readme")
+}
+
+func Test_Pastis_Router_Optional_Parameters(t *testing.T) {
+	router := NewRouter()
+	router.Add("/posts/:id<int>?", "GET", routerTestHandler)
+	router.Add("/archives/:year?/:month?", "GET", routerTestHandler)
+	refute(t, router.Add("/posts", "GET", routerTestHandler), nil)
+	expect(t, router.Add("/posts", "POST", routerTestHandler), nil)
+
+	r, params := router.load().lookup("GET", "/posts/12", nil)
+	expect(t, r.pattern, "/posts/:id<int>?")
+	expect(t, params["id"], "12")
+	r, params = router.load().lookup("GET", "/posts", nil)
+	expect(t, r.pattern, "/posts/:id<int>?")
+	_, ok := params["id"]
+	expect(t, ok, false)
+	r, _ = router.load().lookup("GET", "/posts/twelve", nil)
+	expect(t, r == nil, true)
+
+	r, params = router.load().lookup("GET", "/archives/2020/05", nil)
+	expect(t, params["year"]+"-"+params["month"], "2020-05")
+	r, params = router.load().lookup("GET", "/archives/2020", nil)
+	expect(t, r.pattern, "/archives/:year?/:month?")
+	expect(t, len(params), 1)
+	r, params = router.load().lookup("GET", "/archives", nil)
+	expect(t, r.pattern, "/archives/:year?/:month?")
+	expect(t, len(params), 0)
+	expect(t, len(router.Routes()), 3)
+
+	expect(t, router.Remove("/archives/:year?/:month?", "GET"), nil)
+	r, _ = router.load().lookup("GET", "/archives", nil)
+	expect(t, r == nil, true)
+	expect(t, len(router.Routes()), 2)
+}
+
+func Test_Pastis_Routing_Path(t *testing.T) {
+	cases := []struct {
+		target  string
+		path    string
+		escaped bool
+	}{
+		{"/files/a/b", "/files/a/b", false},
+		{"/files/a%20b", "/files/a b", false},
+		{"/files/a%2Fb", "/files/a%2Fb", true},
+		{"/files/a%2fb%20c%25", "/files/a%2Fb c%25", true},
+		{"/files/%2e%2e%2Fsecret", "/files/..%2Fsecret", true},
+	}
+	for _, c := range cases {
+		path, escaped := routingPath(httptest.NewRequest("GET", c.target, nil).URL)
+		expect(t, path, c.path)
+		expect(t, escaped, c.escaped)
+	}
+}
@@ -0,0 +1,110 @@
+package pastis
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// A RouteInfo describes a route registered on a router.
+type RouteInfo struct {
+	Method  string `json:"method"`
+	Pattern string `json:"pattern"`
+	Host    string `json:"host,omitempty"`
+	Name    string `json:"name,omitempty"`
+	//media types of the request bodies the route consumes and of the responses it produces
+	Consumes []string `json:"consumes,omitempty"`
+	Produces []string `json:"produces,omitempty"`
+	//names of the filters executed before the handler, in execution order
+	Filters []string `json:"filters,omitempty"`
+	//name of the function handling the route
+	Handler string `json:"handler"`
+	//file and line where the route was registered
+	Source string `json:"source"`
+}
+
+// Routes returns the description of every route of the router, sorted by host, pattern and method.
+func (router *Router) Routes() []RouteInfo {
+	var routes []RouteInfo
+	router.load().each(func(r *route) {
+		routes = append(routes, r.info())
+	})
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Host != routes[j].Host {
+			return routes[i].Host < routes[j].Host
+		}
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+//info returns the description of the route.
+func (r *route) info() RouteInfo {
+	return RouteInfo{
+		Method:   r.method,
+		Pattern:  r.pattern,
+		Host:     r.host,
+		Name:     r.name,
+		Consumes: r.consumes,
+		Produces: r.produces,
+		Filters:  r.filters,
+		Handler:  r.handlerName,
+		Source:   r.source,
+	}
+}
+
+//describe is the route option recording the handler and filter names of a route.
+func describe(handlerName string, filters []string) RouteOption {
+	return func(r *route) {
+		r.handlerName = handlerName
+		r.filters = filters
+	}
+}
+
+//funcName returns the name of the given function.
+func funcName(fn interface{}) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return fmt.Sprintf("%T", fn)
+	}
+	if f := runtime.FuncForPC(v.Pointer()); f != nil {
+		return f.Name()
+	}
+	return fmt.Sprintf("%T", fn)
+}
+
+//filterNames returns the names of the given filters.
+func filterNames(filters []Filter) []string {
+	names := make([]string, len(filters))
+	for i, filter := range filters {
+		names[i] = funcName(filter)
+	}
+	return names
+}
+
+//sourceDir is the directory of the pastis source files.
+var sourceDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+//callerLocation returns the location of the first caller outside of the pastis source files.
+func callerLocation() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if filepath.Dir(frame.File) != sourceDir || strings.HasSuffix(frame.File, "_test.go") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
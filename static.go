@@ -0,0 +1,228 @@
+package pastis
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A StaticOption configures how Static serves files.
+type StaticOption func(*staticHandler)
+
+// IndexFile sets the name of the file served for a directory (index.html by default).
+// An empty name disables index files.
+func IndexFile(name string) StaticOption {
+	return func(h *staticHandler) {
+		h.index = name
+	}
+}
+
+// DirectoryListing enables or disables the listing of the directories having no index file (disabled by default).
+func DirectoryListing(enabled bool) StaticOption {
+	return func(h *staticHandler) {
+		h.browse = enabled
+	}
+}
+
+//staticHandler serves the files of a file system.
+type staticHandler struct {
+	fsys fs.FS
+	//name of the file served for a directory
+	index string
+	//whether directories having no index file are listed
+	browse bool
+	//handler called when no file matches the request path
+	notFound http.HandlerFunc
+}
+
+// Static serves the files of root below the given prefix, through the API filters.
+// The root is either a directory name or a fs.FS.
+//
+// Files are served with their Last-Modified and ETag headers, so that conditional and range requests are supported.
+// When the request accepts gzip encoding and a precompressed variant of the file exists (same name followed by .gz), the variant is served instead.
+// Paths escaping the root are never served.
+func (api *API) Static(prefix string, root interface{}, options ...StaticOption) error {
+	return api.static(prefix, root, nil, nil, options)
+}
+
+//static serves the files of root filtered by the given filters after the API ones.
+func (api *API) static(prefix string, root interface{}, filters []Filter, routeOptions []RouteOption, options []StaticOption) error {
+	var fsys fs.FS
+	switch r := root.(type) {
+	case string:
+		fsys = os.DirFS(r)
+	case fs.FS:
+		fsys = r
+	default:
+		return fmt.Errorf("cannot serve static files of %T: root should be a directory name or a fs.FS", root)
+	}
+	h := &staticHandler{fsys: fsys, index: "index.html"}
+	for _, option := range options {
+		option(h)
+	}
+	h.notFound = api.errorHandler(http.StatusNotFound, func(request *http.Request) string {
+		return fmt.Sprintf("no file matches %s", request.URL.Path)
+	})
+	return api.mount("GET", prefix, h, filters, routeOptions)
+}
+
+func (h *staticHandler) ServeHTTP(rw http.ResponseWriter, request *http.Request) {
+	if strings.ContainsAny(request.URL.Path, "\\\x00") {
+		h.notFound(rw, request)
+		return
+	}
+	//cleaning a rooted path removes every .. element that would escape the root
+	name := strings.TrimPrefix(path.Clean("/"+request.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
+	info, err := fs.Stat(h.fsys, name)
+	if err != nil {
+		h.notFound(rw, request)
+		return
+	}
+	if !info.IsDir() {
+		h.serveFile(rw, request, name, info)
+		return
+	}
+	//the stripped path of the mount root is always "/", so the requested path tells whether the slash is missing
+	if requested := mountedPath(request); !strings.HasSuffix(requested, "/") {
+		//the redirection is relative since the handler does not know the prefix it is served below
+		location := url.URL{Path: path.Base(requested) + "/", RawQuery: request.URL.RawQuery}
+		rw.Header().Set("Location", location.String())
+		rw.WriteHeader(http.StatusMovedPermanently)
+		return
+	}
+	if h.index != "" {
+		indexName := path.Join(name, h.index)
+		if indexInfo, err := fs.Stat(h.fsys, indexName); err == nil && !indexInfo.IsDir() {
+			h.serveFile(rw, request, indexName, indexInfo)
+			return
+		}
+	}
+	if !h.browse {
+		h.notFound(rw, request)
+		return
+	}
+	h.serveDir(rw, request, name, info)
+}
+
+//serveFile serves a file, or its precompressed variant when the request accepts it.
+func (h *staticHandler) serveFile(rw http.ResponseWriter, request *http.Request, name string, info fs.FileInfo) {
+	if gzInfo, err := fs.Stat(h.fsys, name+".gz"); err == nil && !gzInfo.IsDir() {
+		rw.Header().Add("Vary", "Accept-Encoding")
+		if acceptsGzip(request.Header.Get("Accept-Encoding")) {
+			rw.Header().Set("Content-Type", h.contentType(name))
+			rw.Header().Set("Content-Encoding", "gzip")
+			name, info = name+".gz", gzInfo
+		}
+	}
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		h.notFound(rw, request)
+		return
+	}
+	defer f.Close()
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			writeProblem(rw, NewProblem(http.StatusInternalServerError, "the request could not be handled"))
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	tag, err := etag(info, content)
+	if err != nil {
+		writeProblem(rw, NewProblem(http.StatusInternalServerError, "the request could not be handled"))
+		return
+	}
+	rw.Header().Set("ETag", tag)
+	http.ServeContent(rw, request, path.Base(name), info.ModTime(), content)
+}
+
+//serveDir lists the entries of a directory as HTML links.
+func (h *staticHandler) serveDir(rw http.ResponseWriter, request *http.Request, name string, info fs.FileInfo) {
+	entries, err := fs.ReadDir(h.fsys, name)
+	if err != nil {
+		h.notFound(rw, request)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	var listing bytes.Buffer
+	listing.WriteString("<!doctype html>\n<pre>\n")
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		link := url.URL{Path: entryName}
+		fmt.Fprintf(&listing, "<a href=\"%s\">%s</a>\n", link.String(), html.EscapeString(entryName))
+	}
+	listing.WriteString("</pre>\n")
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if !info.ModTime().IsZero() {
+		rw.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+	rw.Write(listing.Bytes())
+}
+
+//contentType returns the media type of a file served through its precompressed variant: the type of its extension,
+//or else the type sniffed from its first bytes as http.ServeContent does for the files served as they are.
+func (h *staticHandler) contentType(name string) string {
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		return ctype
+	}
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+	var sniffed [512]byte
+	n, _ := io.ReadFull(f, sniffed[:])
+	return http.DetectContentType(sniffed[:n])
+}
+
+//etag returns the entity tag of a file, built from its size and modification time.
+//Files having no modification time, such as the files of an embed.FS, are told apart by a hash of their content instead.
+func etag(info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if !info.ModTime().IsZero() {
+		return fmt.Sprintf("\"%x-%x\"", info.Size(), info.ModTime().UnixNano()), nil
+	}
+	hash := fnv.New64a()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("\"%x-%x\"", info.Size(), hash.Sum64()), nil
+}
+
+//acceptsGzip reports whether an Accept-Encoding header value accepts the gzip encoding.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(coding), ";")
+		if name = strings.TrimSpace(name); name != "gzip" && name != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if value, err := strconv.ParseFloat(q, 64); err == nil && value == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
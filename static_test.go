@@ -0,0 +1,213 @@
+package pastis
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func staticRequest(p *API, method string, path string, header http.Header) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, nil)
+	for k, v := range header {
+		request.Header[k] = v
+	}
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, request)
+	return rw
+}
+
+func gzipped(s string) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write([]byte(s))
+	w.Close()
+	return b.Bytes()
+}
+
+func Test_Pastis_Static(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"app.js":           {Data: []byte("console.log('app')"), ModTime: modTime},
+		"app.js.gz":        {Data: gzipped("console.log('app')"), ModTime: modTime},
+		"css/main.css":     {Data: []byte("body{margin:0}"), ModTime: modTime},
+		"docs/index.html":  {Data: []byte("<h1>docs</h1>"), ModTime: modTime},
+		"images/logo.svg":  {Data: []byte("<svg/>"), ModTime: modTime},
+		"images/a b.svg":   {Data: []byte("<svg/>"), ModTime: modTime},
+		"images/large.txt": {Data: []byte("0123456789"), ModTime: modTime},
+	}
+	p := NewAPI()
+	p.AddFilter(tracingFilter("api"))
+	expect(t, p.Static("/assets", fsys), nil)
+	expect(t, p.Group("/public").Static("/files", fsys, DirectoryListing(true)), nil)
+	refute(t, p.Static("/invalid", 42), nil)
+	p.HandleFunc()
+
+	res := staticRequest(p, "GET", "/assets/css/main.css", nil)
+	expect(t, res.Code, http.StatusOK)
+	expect(t, res.Body.String(), "body{margin:0}")
+	expect(t, res.Header().Get("Content-Type"), "text/css; charset=utf-8")
+	expect(t, res.Header().Get("Last-Modified"), "Thu, 02 Jan 2020 03:04:05 GMT")
+	expect(t, res.Header().Get("X-Trace"), "api")
+	etag := res.Header().Get("ETag")
+	refute(t, etag, "")
+
+	res = staticRequest(p, "GET", "/assets/css/main.css", http.Header{"If-None-Match": {etag}})
+	expect(t, res.Code, http.StatusNotModified)
+	res = staticRequest(p, "GET", "/assets/css/main.css", http.Header{"If-Modified-Since": {"Thu, 02 Jan 2020 03:04:05 GMT"}})
+	expect(t, res.Code, http.StatusNotModified)
+
+	res = staticRequest(p, "GET", "/assets/images/large.txt", http.Header{"Range": {"bytes=2-4"}})
+	expect(t, res.Code, http.StatusPartialContent)
+	expect(t, res.Body.String(), "234")
+	expect(t, res.Header().Get("Content-Range"), "bytes 2-4/10")
+
+	res = staticRequest(p, "HEAD", "/assets/css/main.css", nil)
+	expect(t, res.Code, http.StatusOK)
+	expect(t, res.Body.Len(), 0)
+	expect(t, res.Header().Get("Content-Length"), "14")
+
+	res = staticRequest(p, "POST", "/assets/css/main.css", nil)
+	expect(t, res.Code, http.StatusMethodNotAllowed)
+}
+
+func Test_Pastis_Static_Precompressed(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.js":    {Data: []byte("console.log('app')")},
+		"app.js.gz": {Data: gzipped("console.log('app')")},
+	}
+	p := NewAPI()
+	p.Static("/assets", fsys)
+	p.HandleFunc()
+
+	res := staticRequest(p, "GET", "/assets/app.js", http.Header{"Accept-Encoding": {"br, gzip"}})
+	expect(t, res.Code, http.StatusOK)
+	expect(t, res.Header().Get("Content-Encoding"), "gzip")
+	expect(t, res.Header().Get("Content-Type"), "text/javascript; charset=utf-8")
+	expect(t, res.Header().Get("Vary"), "Accept-Encoding")
+	expect(t, bytes.Equal(res.Body.Bytes(), gzipped("console.log('app')")), true)
+
+	for _, acceptEncoding := range []string{"", "br", "gzip;q=0"} {
+		res = staticRequest(p, "GET", "/assets/app.js", http.Header{"Accept-Encoding": {acceptEncoding}})
+		expect(t, res.Header().Get("Content-Encoding"), "")
+		expect(t, res.Header().Get("Vary"), "Accept-Encoding")
+		expect(t, res.Body.String(), "console.log('app')")
+	}
+
+	//the files having an unknown extension are sniffed from their uncompressed content
+	fsys["LICENSE"] = &fstest.MapFile{Data: []byte("MIT License")}
+	fsys["LICENSE.gz"] = &fstest.MapFile{Data: gzipped("MIT License")}
+	fsys["data.xyz"] = &fstest.MapFile{Data: []byte{0, 1, 2, 3}}
+	fsys["data.xyz.gz"] = &fstest.MapFile{Data: gzipped("\x00\x01\x02\x03")}
+	res = staticRequest(p, "GET", "/assets/LICENSE", http.Header{"Accept-Encoding": {"gzip"}})
+	expect(t, res.Header().Get("Content-Encoding"), "gzip")
+	expect(t, res.Header().Get("Content-Type"), "text/plain; charset=utf-8")
+	res = staticRequest(p, "GET", "/assets/data.xyz", http.Header{"Accept-Encoding": {"gzip"}})
+	expect(t, res.Header().Get("Content-Encoding"), "gzip")
+	expect(t, res.Header().Get("Content-Type"), "application/octet-stream")
+}
+
+func Test_Pastis_Static_No_ModTime(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt": {Data: []byte("aaaa")},
+		"b.txt": {Data: []byte("bbbb")},
+	}
+	p := NewAPI()
+	p.Static("/assets", fsys, DirectoryListing(true))
+	p.HandleFunc()
+
+	res := staticRequest(p, "GET", "/assets/a.txt", nil)
+	expect(t, res.Code, http.StatusOK)
+	expect(t, res.Header().Get("Last-Modified"), "")
+	etag := res.Header().Get("ETag")
+	expect(t, strings.HasPrefix(etag, "\"4-"), true)
+	refute(t, staticRequest(p, "GET", "/assets/b.txt", nil).Header().Get("ETag"), etag)
+	expect(t, staticRequest(p, "GET", "/assets/a.txt", nil).Header().Get("ETag"), etag)
+
+	res = staticRequest(p, "GET", "/assets/a.txt", http.Header{"If-None-Match": {etag}})
+	expect(t, res.Code, http.StatusNotModified)
+	res = staticRequest(p, "GET", "/assets/a.txt", http.Header{"Range": {"bytes=1-2"}})
+	expect(t, res.Code, http.StatusPartialContent)
+	expect(t, res.Body.String(), "aa")
+
+	res = staticRequest(p, "GET", "/assets/", nil)
+	expect(t, res.Code, http.StatusOK)
+	expect(t, res.Header().Get("Last-Modified"), "")
+}
+
+func Test_Pastis_Static_Directories(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":      {Data: []byte("<h1>home</h1>")},
+		"docs/index.html": {Data: []byte("<h1>docs</h1>")},
+		"what?now/x":      {Data: []byte("x")},
+		"images/logo.svg": {Data: []byte("<svg/>")},
+		"images/a b.svg":  {Data: []byte("<svg/>")},
+		"images/icons/x":  {Data: []byte("x")},
+	}
+	p := NewAPI()
+	p.Static("/assets", fsys)
+	p.Static("/browse", fsys, DirectoryListing(true), IndexFile(""))
+	p.HandleFunc()
+
+	res := staticRequest(p, "GET", "/assets/docs/", nil)
+	expect(t, res.Code, http.StatusOK)
+	expect(t, res.Body.String(), "<h1>docs</h1>")
+
+	res = staticRequest(p, "GET", "/assets/docs", nil)
+	expect(t, res.Code, http.StatusMovedPermanently)
+	expect(t, res.Header().Get("Location"), "docs/")
+
+	res = staticRequest(p, "GET", "/assets?v=2", nil)
+	expect(t, res.Code, http.StatusMovedPermanently)
+	expect(t, res.Header().Get("Location"), "assets/?v=2")
+
+	res = staticRequest(p, "GET", "/assets/", nil)
+	expect(t, res.Code, http.StatusOK)
+	expect(t, res.Body.String(), "<h1>home</h1>")
+
+	res = staticRequest(p, "GET", "/assets/what%3Fnow", nil)
+	expect(t, res.Code, http.StatusMovedPermanently)
+	expect(t, res.Header().Get("Location"), "what%3Fnow/")
+
+	res = staticRequest(p, "GET", "/assets/images/", nil)
+	assert_Error_Response(t, res.Result(), http.StatusNotFound)
+
+	res = staticRequest(p, "GET", "/browse/images/", nil)
+	expect(t, res.Code, http.StatusOK)
+	expect(t, res.Header().Get("Content-Type"), "text/html; charset=utf-8")
+	listing := res.Body.String()
+	expect(t, strings.Contains(listing, `<a href="a%20b.svg">a b.svg</a>`), true)
+	expect(t, strings.Contains(listing, `<a href="icons/">icons/</a>`), true)
+	expect(t, strings.Index(listing, "a%20b.svg") < strings.Index(listing, "logo.svg"), true)
+
+	res = staticRequest(p, "GET", "/browse/docs/", nil)
+	expect(t, strings.Contains(res.Body.String(), `<a href="index.html">`), true)
+}
+
+func Test_Pastis_Static_Traversal(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("classified"), 0600)
+	os.Mkdir(filepath.Join(dir, "public"), 0700)
+	os.WriteFile(filepath.Join(dir, "public", "hello.txt"), []byte("hello"), 0600)
+
+	p := NewAPI()
+	p.SetPathPolicy(PathStrict)
+	p.Static("/assets", filepath.Join(dir, "public"))
+	p.HandleFunc()
+
+	res := staticRequest(p, "GET", "/assets/hello.txt", nil)
+	expect(t, res.Code, http.StatusOK)
+	expect(t, res.Body.String(), "hello")
+
+	for _, path := range []string{"/assets/../secret.txt", "/assets/x/../../secret.txt", "/assets/%2e%2e/secret.txt", "/assets/..%5csecret.txt", "/assets/missing.txt"} {
+		res = staticRequest(p, "GET", path, nil)
+		expect(t, res.Code, http.StatusNotFound)
+		expect(t, strings.Contains(res.Body.String(), "classified"), false)
+	}
+}
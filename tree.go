@@ -0,0 +1,609 @@
+package pastis
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//route is a single registered handler, paired with a request method and the URL-pattern it was registered with.
+type route struct {
+	method  string
+	pattern string
+	//media types of the request bodies the route accepts and of the responses it produces (any when empty)
+	consumes []string
+	produces []string
+	//optional name used to build the route URL
+	name string
+	//optional host pattern the route is restricted to
+	host string
+	//names of the filters and function handling the route, for introspection
+	filters     []string
+	handlerName string
+	//location where the route was registered
+	source string
+	//whether the route serves a handler mounted below the pattern prefix
+	mount bool
+	//whether the API filters are skipped
+	unfiltered bool
+	//names of the path parameters in the order their values are captured
+	params  []string
+	handler http.HandlerFunc
+}
+
+//node is a path segment of the routing tree.
+//Lookups walk the tree one segment at a time so that the matching cost depends on the
+//length of the request path rather than on the number of routes.
+type node struct {
+	//children matching a literal path segment
+	static map[string]*node
+	//children matching a non-empty path segment (:name), constrained ones first
+	params []*node
+	//constraint satisfied by the path segment of a parameter node (nil when unconstrained)
+	constraint *constraint
+	//child matching the rest of the path (**)
+	catchAll *node
+	//routes ending at this node keyed by request method, in registration order.
+	//Routes of the same method differ by the media types they consume or produce.
+	routes map[string][]*route
+}
+
+//regexpNode holds the routes whose pattern cannot be expressed as tree segments
+//(embedded regular expression groups for instance). They are compiled once and tried in registration order.
+type regexpNode struct {
+	pattern string
+	regexp  *regexp.Regexp
+	routes  map[string][]*route
+}
+
+//table is a set of routes made of a tree and a list of regular expression routes.
+type table struct {
+	//tree of the routes made of literal segments, named parameters and catch-alls
+	root *node
+	//routes embedding regular expressions
+	regexps []*regexpNode
+}
+
+//add adds a route whose pattern is made of the given segments.
+//It returns the route previously added with the same method that matches the same paths, without adding the new one.
+//The nodes shared with other tables are left untouched.
+func (t *table) add(r *route, segments []segment) *route {
+	root, existing := t.root.with(segments, r)
+	if existing == nil {
+		t.root = root
+	}
+	return existing
+}
+
+//addRegexp adds a route whose pattern is compiled into the given regular expression.
+//It returns the route previously added with the same method and pattern, without adding the new one.
+func (t *table) addRegexp(r *route, regexp *regexp.Regexp) *route {
+	for i, n := range t.regexps {
+		if n.pattern == r.pattern {
+			if existing := conflicting(n.routes[r.method], r); existing != nil {
+				return existing
+			}
+			t.regexps[i] = n.with(r.method, appendRoute(n.routes[r.method], r))
+			return nil
+		}
+	}
+	t.regexps = append(t.regexps, &regexpNode{pattern: r.pattern, regexp: regexp, routes: map[string][]*route{r.method: {r}}})
+	return nil
+}
+
+//remove removes the route having the method, pattern and media types of target, whose pattern is made of the given segments.
+//It returns the removed route or nil when the table has no such route.
+func (t *table) remove(target *route, segments []segment) *route {
+	root, removed := t.root.without(segments, target)
+	if removed != nil {
+		t.root = root
+	}
+	return removed
+}
+
+//removeRegexp removes the route having the method, regular expression pattern and media types of target.
+//It returns the removed route or nil when the table has no such route.
+func (t *table) removeRegexp(target *route) *route {
+	for i, n := range t.regexps {
+		if n.pattern == target.pattern {
+			routes, removed := without(n.routes[target.method], target)
+			if removed == nil {
+				return nil
+			}
+			if len(routes) == 0 && len(n.routes) == 1 {
+				t.regexps = append(t.regexps[:i:i], t.regexps[i+1:]...)
+			} else {
+				t.regexps[i] = n.with(target.method, routes)
+			}
+			return removed
+		}
+	}
+	return nil
+}
+
+//conflicting returns the route of the given ones that may be chosen for the same requests as r, if any.
+func conflicting(routes []*route, r *route) *route {
+	for _, existing := range routes {
+		if existing.overlaps(r) {
+			return existing
+		}
+	}
+	return nil
+}
+
+//appendRoute returns a copy of the given routes followed by r, leaving the given routes untouched.
+func appendRoute(routes []*route, r *route) []*route {
+	return append(routes[:len(routes):len(routes)], r)
+}
+
+//without returns a copy of the given routes without the route having the pattern and media types of target, along with the removed route.
+func without(routes []*route, target *route) ([]*route, *route) {
+	for i, r := range routes {
+		if r.pattern == target.pattern && r.sameMedia(target) {
+			return append(routes[:i:i], routes[i+1:]...), r
+		}
+	}
+	return routes, nil
+}
+
+//copy returns a copy of the table which may be modified without modifying t.
+func (t *table) copy() table {
+	return table{root: t.root, regexps: append([]*regexpNode(nil), t.regexps...)}
+}
+
+//empty reports whether the table has no route.
+func (t *table) empty() bool {
+	return t.root.empty() && len(t.regexps) == 0
+}
+
+//with returns a copy of the regular expression node having the given routes for the given method.
+func (n *regexpNode) with(method string, methodRoutes []*route) *regexpNode {
+	routes := make(map[string][]*route, len(n.routes)+1)
+	for m, existing := range n.routes {
+		routes[m] = existing
+	}
+	if len(methodRoutes) == 0 {
+		delete(routes, method)
+	} else {
+		routes[method] = methodRoutes
+	}
+	return &regexpNode{pattern: n.pattern, regexp: n.regexp, routes: routes}
+}
+
+//AnyMethod is the method of the routes matching any request method.
+//A route registered for a given method takes precedence over a route matching any method on the same pattern.
+const AnyMethod = "*"
+
+//routeFor returns the route of the given method, or the route matching any method, chosen by the given negotiation.
+func routeFor(routes map[string][]*route, method string, n *negotiation) *route {
+	if r := n.choose(routes[method]); r != nil {
+		return r
+	}
+	return n.choose(routes[AnyMethod])
+}
+
+//lookup returns the route matching the given method and path, along with its path parameters.
+//Among the routes differing by their media types, the route is chosen by the given negotiation, or is the first one added when it is nil.
+//The tree is searched first, then the regular expression routes in registration order.
+func (t *table) lookup(method string, path string, n *negotiation) (*route, map[string]string) {
+	if leaf, values := t.root.lookup(method, rootPath(path), make([]string, 0, 4), n); leaf != nil {
+		r := routeFor(leaf.routes, method, n)
+		//values of the omitted optional parameters are missing
+		params := make(map[string]string, len(values))
+		for i, value := range values {
+			params[r.params[i]] = value
+		}
+		return r, params
+	}
+	for _, rn := range t.regexps {
+		if r := routeFor(rn.routes, method, n); r != nil {
+			if ok, params := Match(rn.regexp, path); ok {
+				return r, params
+			}
+		}
+	}
+	return nil, nil
+}
+
+//methods collects the methods of the routes matching the given path.
+func (t *table) methods(path string, methods map[string]bool) {
+	t.root.methods(rootPath(path), methods)
+	for _, n := range t.regexps {
+		if ok, _ := Match(n.regexp, path); ok {
+			for method := range n.routes {
+				methods[method] = true
+			}
+		}
+	}
+}
+
+//sortedMethods returns the given set of methods as a sorted slice.
+func sortedMethods(methods map[string]bool) []string {
+	sorted := make([]string, 0, len(methods))
+	for method := range methods {
+		sorted = append(sorted, method)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+//each calls fn for every route of the table, in precedence order.
+func (t *table) each(fn func(*route)) {
+	t.root.walk(fn)
+	for _, n := range t.regexps {
+		methods := make([]string, 0, len(n.routes))
+		for method := range n.routes {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			for _, r := range n.routes[method] {
+				fn(r)
+			}
+		}
+	}
+}
+
+const (
+	staticSegment = iota
+	paramSegment
+	catchAllSegment
+)
+
+//segment is a parsed component of an URL-pattern.
+type segment struct {
+	kind       int
+	value      string
+	constraint *constraint
+	//whether the path may end before this segment (:name?)
+	optional bool
+}
+
+//regexpChars are the characters turning a pattern segment into a regular expression.
+const regexpChars = `\+*?()|[]{}^$`
+
+//parsePattern splits an URL-pattern into tree segments along with the names of its parameters.
+//It returns false when the pattern has to be matched with a regular expression.
+//Optional parameters (:name?) may only end a tree pattern, and so may a catch-all (** or *name).
+func (rt *routing) parsePattern(pattern string) ([]segment, []string, bool) {
+	parts := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	segments := make([]segment, 0, len(parts))
+	var names []string
+	for i, part := range parts {
+		optional := strings.HasPrefix(part, ":") && strings.HasSuffix(part, "?")
+		if !optional && len(segments) > 0 && segments[len(segments)-1].optional {
+			return nil, nil, false
+		}
+		switch {
+		case part == "**":
+			if i != len(parts)-1 {
+				return nil, nil, false
+			}
+			//unnamed catch-alls are named after their Regexp group
+			names = append(names, "_1")
+			segments = append(segments, segment{kind: catchAllSegment, value: part})
+		case strings.HasPrefix(part, "*") && isParamName(part[1:]):
+			if i != len(parts)-1 {
+				return nil, nil, false
+			}
+			names = append(names, part[1:])
+			segments = append(segments, segment{kind: catchAllSegment, value: part[1:]})
+		case strings.HasPrefix(part, ":"):
+			name, c, ok := rt.parseParam(strings.TrimSuffix(part[1:], "?"))
+			if !ok {
+				return nil, nil, false
+			}
+			names = append(names, name)
+			segments = append(segments, segment{kind: paramSegment, value: name, constraint: c, optional: optional})
+		case strings.ContainsAny(part, regexpChars+":"):
+			return nil, nil, false
+		default:
+			segments = append(segments, segment{kind: staticSegment, value: part})
+		}
+	}
+	return segments, names, true
+}
+
+//variants returns the segments of the paths matched by a pattern, that is the pattern segments
+//followed by the shorter paths omitting its optional parameters, from the last one to the first one.
+func variants(segments []segment) [][]segment {
+	all := [][]segment{segments}
+	for i := len(segments) - 1; i >= 0 && segments[i].optional; i-- {
+		all = append(all, segments[:i])
+	}
+	return all
+}
+
+//parseParam parses a path parameter declaration (name or name<constraint>) into its name and constraint.
+func (rt *routing) parseParam(param string) (string, *constraint, bool) {
+	i := strings.IndexByte(param, '<')
+	if i < 0 {
+		return param, nil, isParamName(param)
+	}
+	if !strings.HasSuffix(param, ">") || !isParamName(param[:i]) {
+		return "", nil, false
+	}
+	c, err := rt.constraint(param[i+1 : len(param)-1])
+	if err != nil {
+		return "", nil, false
+	}
+	return param[:i], c, true
+}
+
+//isParamName reports whether name is a valid path parameter name.
+func isParamName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/#?().\:`+regexpChars)
+}
+
+//rootPath makes sure a path starts with a slash.
+func rootPath(path string) string {
+	if strings.HasPrefix(path, "/") {
+		return path
+	}
+	return "/" + path
+}
+
+//nextSegment splits a path starting with a slash into its first segment and the rest of the path.
+//A path ending with a slash ends with an empty segment.
+func nextSegment(path string) (string, string) {
+	path = path[1:]
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		return path[:i], path[i:]
+	}
+	return path, ""
+}
+
+//copy returns a shallow copy of n whose children and routes may be replaced without modifying n.
+func (n *node) copy() *node {
+	c := &node{constraint: n.constraint, catchAll: n.catchAll, params: append([]*node(nil), n.params...)}
+	c.static = make(map[string]*node, len(n.static))
+	for seg, child := range n.static {
+		c.static[seg] = child
+	}
+	c.routes = make(map[string][]*route, len(n.routes))
+	for method, r := range n.routes {
+		c.routes[method] = r
+	}
+	return c
+}
+
+//empty reports whether no route is registered at or below n.
+func (n *node) empty() bool {
+	return len(n.routes) == 0 && len(n.static) == 0 && len(n.params) == 0 && n.catchAll == nil
+}
+
+//with returns a copy of n having the given route at the node matching the given segments.
+//Only the nodes along the segments are copied so that the copy shares the rest of the tree with n.
+//When a route is already registered there for the same method, it is returned along with n.
+func (n *node) with(segments []segment, r *route) (*node, *route) {
+	if len(segments) == 0 {
+		if existing := conflicting(n.routes[r.method], r); existing != nil {
+			return n, existing
+		}
+		c := n.copy()
+		c.routes[r.method] = appendRoute(n.routes[r.method], r)
+		return c, nil
+	}
+	s, rest := segments[0], segments[1:]
+	switch s.kind {
+	case staticSegment:
+		child := n.static[s.value]
+		if child == nil {
+			child = &node{}
+		}
+		child, existing := child.with(rest, r)
+		if existing != nil {
+			return n, existing
+		}
+		c := n.copy()
+		c.static[s.value] = child
+		return c, nil
+	case paramSegment:
+		i, found := n.paramIndex(s.constraint)
+		child := &node{constraint: s.constraint}
+		if found {
+			child = n.params[i]
+		}
+		child, existing := child.with(rest, r)
+		if existing != nil {
+			return n, existing
+		}
+		c := n.copy()
+		if found {
+			c.params[i] = child
+		} else {
+			c.params = append(c.params[:i], append([]*node{child}, c.params[i:]...)...)
+		}
+		return c, nil
+	default:
+		child := n.catchAll
+		if child == nil {
+			child = &node{}
+		}
+		child, existing := child.with(rest, r)
+		if existing != nil {
+			return n, existing
+		}
+		c := n.copy()
+		c.catchAll = child
+		return c, nil
+	}
+}
+
+//without returns a copy of n without the route having the method, pattern and media types of target registered at the node matching
+//the given segments, along with the removed route. Nodes left without any route below them are pruned.
+//When there is no such route, it returns n and nil.
+func (n *node) without(segments []segment, target *route) (*node, *route) {
+	if len(segments) == 0 {
+		routes, removed := without(n.routes[target.method], target)
+		if removed == nil {
+			return n, nil
+		}
+		c := n.copy()
+		if len(routes) == 0 {
+			delete(c.routes, target.method)
+		} else {
+			c.routes[target.method] = routes
+		}
+		return c, removed
+	}
+	s, rest := segments[0], segments[1:]
+	switch s.kind {
+	case staticSegment:
+		child := n.static[s.value]
+		if child == nil {
+			return n, nil
+		}
+		child, removed := child.without(rest, target)
+		if removed == nil {
+			return n, nil
+		}
+		c := n.copy()
+		if child.empty() {
+			delete(c.static, s.value)
+		} else {
+			c.static[s.value] = child
+		}
+		return c, removed
+	case paramSegment:
+		i, found := n.paramIndex(s.constraint)
+		if !found {
+			return n, nil
+		}
+		child, removed := n.params[i].without(rest, target)
+		if removed == nil {
+			return n, nil
+		}
+		c := n.copy()
+		if child.empty() {
+			c.params = append(c.params[:i], c.params[i+1:]...)
+		} else {
+			c.params[i] = child
+		}
+		return c, removed
+	default:
+		if n.catchAll == nil {
+			return n, nil
+		}
+		child, removed := n.catchAll.without(rest, target)
+		if removed == nil {
+			return n, nil
+		}
+		c := n.copy()
+		c.catchAll = child
+		if child.empty() {
+			c.catchAll = nil
+		}
+		return c, removed
+	}
+}
+
+//paramIndex returns the index of the parameter child having the given constraint and true when there is one.
+//Otherwise it returns the index where such a child belongs: constrained children are kept in registration order,
+//before the unconstrained one.
+func (n *node) paramIndex(c *constraint) (int, bool) {
+	for i, child := range n.params {
+		if child.constraint.equal(c) {
+			return i, true
+		}
+	}
+	last := len(n.params)
+	if c != nil && last > 0 && n.params[last-1].constraint == nil {
+		return last - 1, false
+	}
+	return last, false
+}
+
+//accepts reports whether the value of a path segment satisfies the constraint of a parameter node.
+func (n *node) accepts(seg string) bool {
+	return seg != "" && (n.constraint == nil || n.constraint.regexp.MatchString(seg))
+}
+
+//lookup finds the node matching the given path and having a route for the given method chosen by the given negotiation.
+//Path parameter values are appended to values in capture order.
+//
+//Segments are matched from left to right. At each segment, a literal segment takes precedence over
+//a constrained parameter, then an unconstrained parameter and finally a catch-all.
+//When the most specific branch cannot route the rest of the path for this method, the next one is tried.
+func (n *node) lookup(method string, path string, values []string, neg *negotiation) (*node, []string) {
+	if path == "" {
+		if routeFor(n.routes, method, neg) != nil {
+			return n, values
+		}
+		if n.catchAll != nil && routeFor(n.catchAll.routes, method, neg) != nil {
+			return n.catchAll, append(values, "")
+		}
+		return nil, values
+	}
+	seg, rest := nextSegment(path)
+	if child := n.static[seg]; child != nil {
+		if leaf, vals := child.lookup(method, rest, values, neg); leaf != nil {
+			return leaf, vals
+		}
+	}
+	for _, child := range n.params {
+		if child.accepts(seg) {
+			if leaf, vals := child.lookup(method, rest, append(values, seg), neg); leaf != nil {
+				return leaf, vals
+			}
+		}
+	}
+	if n.catchAll != nil && routeFor(n.catchAll.routes, method, neg) != nil {
+		return n.catchAll, append(values, path[1:])
+	}
+	return nil, values
+}
+
+//methods collects the methods of every route matching the given path.
+func (n *node) methods(path string, methods map[string]bool) {
+	if path == "" {
+		for method := range n.routes {
+			methods[method] = true
+		}
+	} else {
+		seg, rest := nextSegment(path)
+		if child := n.static[seg]; child != nil {
+			child.methods(rest, methods)
+		}
+		for _, child := range n.params {
+			if child.accepts(seg) {
+				child.methods(rest, methods)
+			}
+		}
+	}
+	if n.catchAll != nil {
+		for method := range n.catchAll.routes {
+			methods[method] = true
+		}
+	}
+}
+
+//walk calls fn for every route registered below n, in precedence order.
+//Routes ending at the same node are visited by method name.
+func (n *node) walk(fn func(*route)) {
+	methods := make([]string, 0, len(n.routes))
+	for method := range n.routes {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		for _, r := range n.routes[method] {
+			fn(r)
+		}
+	}
+	segments := make([]string, 0, len(n.static))
+	for seg := range n.static {
+		segments = append(segments, seg)
+	}
+	sort.Strings(segments)
+	for _, seg := range segments {
+		n.static[seg].walk(fn)
+	}
+	for _, child := range n.params {
+		child.walk(fn)
+	}
+	if n.catchAll != nil {
+		n.catchAll.walk(fn)
+	}
+}
@@ -0,0 +1,436 @@
+package pastis
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// A Validator checks itself once decoded from the request body or bound to the request parameters.
+// A Validate method returning Violations reports each of them, other errors are reported as a violation of the whole value.
+type Validator interface {
+	Validate() error
+}
+
+// A Violation is a constraint that a request value does not satisfy.
+type Violation struct {
+	//Part of the request holding the value: body, path, query or header
+	In string `json:"in,omitempty"`
+	//JSON pointer of the value, relative to the body or to the parameters
+	Pointer string `json:"pointer"`
+	//Constraint that the value does not satisfy
+	Detail string `json:"detail"`
+}
+
+// Violations is the error of a value not satisfying its constraints.
+type Violations []Violation
+
+func (violations Violations) Error() string {
+	details := make([]string, len(violations))
+	for i, violation := range violations {
+		details[i] = fmt.Sprintf("%s %s", violation.Pointer, violation.Detail)
+	}
+	return strings.Join(details, ", ")
+}
+
+//validatorType is the type of the values checking themselves.
+var validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+//A valueValidator appends the violations of the value at p to the given list, the value being located by the given JSON pointer.
+type valueValidator func(p unsafe.Pointer, pointer string, violations *Violations)
+
+//A rule returns the constraint that the value at p does not satisfy, or an empty string.
+type rule func(p unsafe.Pointer) string
+
+//validatorBuilder builds the validators of types.
+type validatorBuilder struct {
+	//validators of the struct types being built or built, so that recursive types are supported
+	structs map[reflect.Type]*valueValidator
+}
+
+//newValidator returns the validator of a type driven by the validate tags of its fields, and the Validate methods of its values.
+//It returns a nil validator when the values of the type have nothing to check.
+func newValidator(t reflect.Type) (valueValidator, error) {
+	b := &validatorBuilder{structs: make(map[reflect.Type]*valueValidator)}
+	return b.typeValidator(t)
+}
+
+//typeValidator returns the validator of the values of a type, that is of the fields of a struct, of the value a pointer points to
+//and of the values implementing Validator. Interface values are not validated since request values cannot set them.
+func (b *validatorBuilder) typeValidator(t reflect.Type) (valueValidator, error) {
+	if t.Kind() == reflect.Ptr {
+		elem, err := b.typeValidator(t.Elem())
+		if elem == nil || err != nil {
+			return nil, err
+		}
+		return func(p unsafe.Pointer, pointer string, violations *Violations) {
+			if elemPointer := *(*unsafe.Pointer)(p); elemPointer != nil {
+				elem(elemPointer, pointer, violations)
+			}
+		}, nil
+	}
+	if validator, ok := b.structs[t]; ok {
+		//the validator of a recursive type is called once built
+		return func(p unsafe.Pointer, pointer string, violations *Violations) {
+			if *validator != nil {
+				(*validator)(p, pointer, violations)
+			}
+		}, nil
+	}
+	var validators []valueValidator
+	if t.Kind() == reflect.Struct {
+		b.structs[t] = new(valueValidator)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			validator, err := b.ruleValidator(field.Tag.Get("validate"), field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("field %s of %v: %v", field.Name, t, err)
+			}
+			if validator != nil {
+				offset, name := field.Offset, escapePointer(fieldName(field))
+				validators = append(validators, func(p unsafe.Pointer, pointer string, violations *Violations) {
+					validator(unsafe.Add(p, offset), pointer+"/"+name, violations)
+				})
+			}
+		}
+	}
+	if t.Kind() != reflect.Interface && reflect.PointerTo(t).Implements(validatorType) {
+		validators = append(validators, validateMethod(t))
+	}
+	var validator valueValidator
+	if len(validators) > 0 {
+		validator = func(p unsafe.Pointer, pointer string, violations *Violations) {
+			for _, validate := range validators {
+				validate(p, pointer, violations)
+			}
+		}
+	}
+	if t.Kind() == reflect.Struct {
+		*b.structs[t] = validator
+	}
+	return validator, nil
+}
+
+//ruleValidator returns the validator of a value checking the rules of a validate tag before the value itself (see typeValidator).
+//The rules are separated by commas: required, min=n, max=n, len=n, enum=a|b|c, email, regexp=expr and dive.
+//The rules following dive apply to the elements of a slice or a map, and since an expression may contain commas, regexp is the
+//last rule of the value it applies to.
+func (b *validatorBuilder) ruleValidator(tag string, t reflect.Type) (valueValidator, error) {
+	var required bool
+	var rules []rule
+	var elem valueValidator
+	valueType := t
+	if valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+	for tag != "" {
+		option, rest, _ := strings.Cut(tag, ",")
+		if strings.HasPrefix(option, "regexp=") {
+			option, rest = tag, ""
+		}
+		tag = rest
+		name, param, _ := strings.Cut(strings.TrimSpace(option), "=")
+		if name == "dive" {
+			if valueType.Kind() != reflect.Slice && valueType.Kind() != reflect.Array && valueType.Kind() != reflect.Map {
+				return nil, fmt.Errorf("dive does not apply to %v", t)
+			}
+			var err error
+			if elem, err = b.ruleValidator(tag, valueType.Elem()); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if name == "required" {
+			required = true
+			continue
+		}
+		r, err := newRule(name, param, valueType)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	nested, err := b.typeValidator(t)
+	if err != nil {
+		return nil, err
+	}
+	if !required && len(rules) == 0 && elem == nil && nested == nil {
+		return nil, nil
+	}
+	missing, zero, indirect := missingOf(t), zeroOf(t), t.Kind() == reflect.Ptr
+	var each func(p unsafe.Pointer, pointer string, violations *Violations)
+	if elem != nil {
+		each = elementsOf(valueType, elem)
+	}
+	return func(p unsafe.Pointer, pointer string, violations *Violations) {
+		if required && (missing(p) || zero(p)) {
+			*violations = append(*violations, Violation{Pointer: pointer, Detail: "is required"})
+			return
+		}
+		if missing(p) {
+			return
+		}
+		if nested != nil {
+			nested(p, pointer, violations)
+		}
+		if indirect {
+			p = *(*unsafe.Pointer)(p)
+		}
+		for _, r := range rules {
+			if detail := r(p); detail != "" {
+				*violations = append(*violations, Violation{Pointer: pointer, Detail: detail})
+			}
+		}
+		if each != nil {
+			each(p, pointer, violations)
+		}
+	}, nil
+}
+
+//elementsOf returns the validator of the elements of a slice, an array or a map, located by their index or their key.
+//The elements of a map, which are not addressable, are validated through reflection.
+func elementsOf(t reflect.Type, elem valueValidator) valueValidator {
+	size := t.Elem().Size()
+	switch t.Kind() {
+	case reflect.Slice:
+		return func(p unsafe.Pointer, pointer string, violations *Violations) {
+			slice := (*sliceHeader)(p)
+			for i := 0; i < slice.len; i++ {
+				elem(unsafe.Add(slice.data, uintptr(i)*size), pointer+"/"+strconv.Itoa(i), violations)
+			}
+		}
+	case reflect.Array:
+		length := t.Len()
+		return func(p unsafe.Pointer, pointer string, violations *Violations) {
+			for i := 0; i < length; i++ {
+				elem(unsafe.Add(p, uintptr(i)*size), pointer+"/"+strconv.Itoa(i), violations)
+			}
+		}
+	}
+	return func(p unsafe.Pointer, pointer string, violations *Violations) {
+		v := reflect.NewAt(t, p).Elem()
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, key := range keys {
+			value := reflect.New(t.Elem())
+			value.Elem().Set(v.MapIndex(key))
+			elem(value.UnsafePointer(), pointer+"/"+escapePointer(fmt.Sprint(key)), violations)
+		}
+	}
+}
+
+//newRule returns the rule of the given name and parameter checking values of the given type.
+func newRule(name string, param string, t reflect.Type) (rule, error) {
+	switch name {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s=%s is not a number", name, param)
+		}
+		measure, unit, err := measureOf(name, t)
+		if err != nil {
+			return nil, err
+		}
+		if name == "min" {
+			return func(p unsafe.Pointer) string {
+				if measure(p) < limit {
+					return fmt.Sprintf("must be at least %s%s", param, unit)
+				}
+				return ""
+			}, nil
+		}
+		return func(p unsafe.Pointer) string {
+			if measure(p) > limit {
+				return fmt.Sprintf("must be at most %s%s", param, unit)
+			}
+			return ""
+		}, nil
+	case "len":
+		length, err := strconv.Atoi(param)
+		if err != nil {
+			return nil, fmt.Errorf("len=%s is not an integer", param)
+		}
+		measure, unit, err := measureOf(name, t)
+		if err != nil || unit == "" {
+			return nil, fmt.Errorf("len does not apply to %v", t)
+		}
+		return func(p unsafe.Pointer) string {
+			if int(measure(p)) != length {
+				return fmt.Sprintf("must have exactly %d%s", length, unit)
+			}
+			return ""
+		}, nil
+	case "enum":
+		switch t.Kind() {
+		case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map, reflect.Interface, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+			return nil, fmt.Errorf("enum does not apply to %v", t)
+		}
+		values := strings.Split(param, "|")
+		typ := typeWordOf(t)
+		return func(p unsafe.Pointer) string {
+			value := fmt.Sprint(interfaceAt(typ, p))
+			for _, allowed := range values {
+				if value == allowed {
+					return ""
+				}
+			}
+			return fmt.Sprintf("must be one of %s", strings.Join(values, ", "))
+		}, nil
+	case "email":
+		if t.Kind() != reflect.String {
+			return nil, fmt.Errorf("email does not apply to %v", t)
+		}
+		return func(p unsafe.Pointer) string {
+			s := *(*string)(p)
+			if address, err := mail.ParseAddress(s); err != nil || address.Address != s {
+				return "must be an email address"
+			}
+			return ""
+		}, nil
+	case "regexp":
+		if t.Kind() != reflect.String {
+			return nil, fmt.Errorf("regexp does not apply to %v", t)
+		}
+		expr, err := regexp.Compile(param)
+		if err != nil {
+			return nil, err
+		}
+		return func(p unsafe.Pointer) string {
+			if !expr.MatchString(*(*string)(p)) {
+				return fmt.Sprintf("must match %s", param)
+			}
+			return ""
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown validation rule %q", name)
+}
+
+//measureOf returns the function measuring the values of a type compared by the min, max and len rules: the number itself
+//or the length of a string, a slice or a map, followed by its unit.
+func measureOf(name string, t reflect.Type) (func(p unsafe.Pointer) float64, string, error) {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		read := intOf(t.Size())
+		return func(p unsafe.Pointer) float64 { return float64(read(p)) }, "", nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		read := uintOf(t.Size())
+		return func(p unsafe.Pointer) float64 { return float64(read(p)) }, "", nil
+	case reflect.Float32, reflect.Float64:
+		return floatOf(t.Size()), "", nil
+	case reflect.String:
+		return func(p unsafe.Pointer) float64 { return float64(utf8.RuneCountInString(*(*string)(p))) }, " characters", nil
+	case reflect.Slice:
+		return func(p unsafe.Pointer) float64 { return float64((*sliceHeader)(p).len) }, " elements", nil
+	case reflect.Array:
+		length := float64(t.Len())
+		return func(p unsafe.Pointer) float64 { return length }, " elements", nil
+	case reflect.Map:
+		return func(p unsafe.Pointer) float64 { return float64(mapLen(p)) }, " elements", nil
+	}
+	return nil, "", fmt.Errorf("%s does not apply to %v", name, t)
+}
+
+//validateMethod returns the validator calling the Validate method of the values of a type, whose pointers implement Validator.
+func validateMethod(t reflect.Type) valueValidator {
+	pointerType := typeWordOf(reflect.PointerTo(t))
+	return func(p unsafe.Pointer, pointer string, violations *Violations) {
+		err := interfaceAt(pointerType, p).(Validator).Validate()
+		if err == nil {
+			return
+		}
+		if reported, ok := err.(Violations); ok {
+			for _, violation := range reported {
+				violation.Pointer = pointer + violation.Pointer
+				*violations = append(*violations, violation)
+			}
+			return
+		}
+		*violations = append(*violations, Violation{Pointer: pointer, Detail: err.Error()})
+	}
+}
+
+//missingOf returns the function reporting whether a value of a type is missing, that is a nil pointer or an empty string,
+//slice or map. The rules other than required do not apply to missing values.
+func missingOf(t reflect.Type) func(p unsafe.Pointer) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return func(p unsafe.Pointer) bool { return *(*unsafe.Pointer)(p) == nil }
+	case reflect.String:
+		return func(p unsafe.Pointer) bool { return len(*(*string)(p)) == 0 }
+	case reflect.Slice:
+		return func(p unsafe.Pointer) bool { return (*sliceHeader)(p).len == 0 }
+	case reflect.Map:
+		return func(p unsafe.Pointer) bool { return mapLen(p) == 0 }
+	}
+	return func(p unsafe.Pointer) bool { return false }
+}
+
+//zeroOf returns the function reporting whether a value of a type is the zero value, which does not satisfy the required rule.
+func zeroOf(t reflect.Type) func(p unsafe.Pointer) bool {
+	switch t.Kind() {
+	case reflect.String:
+		return func(p unsafe.Pointer) bool { return len(*(*string)(p)) == 0 }
+	case reflect.Struct:
+		var offsets []uintptr
+		var fields []func(p unsafe.Pointer) bool
+		for i := 0; i < t.NumField(); i++ {
+			offsets = append(offsets, t.Field(i).Offset)
+			fields = append(fields, zeroOf(t.Field(i).Type))
+		}
+		return func(p unsafe.Pointer) bool {
+			for i, zero := range fields {
+				if !zero(unsafe.Add(p, offsets[i])) {
+					return false
+				}
+			}
+			return true
+		}
+	case reflect.Array:
+		zero, size, length := zeroOf(t.Elem()), t.Elem().Size(), t.Len()
+		return func(p unsafe.Pointer) bool {
+			for i := 0; i < length; i++ {
+				if !zero(unsafe.Add(p, uintptr(i)*size)) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	//the other values are zero when all their bytes are
+	size := int(t.Size())
+	return func(p unsafe.Pointer) bool {
+		for _, b := range unsafe.Slice((*byte)(p), size) {
+			if b != 0 {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+//fieldName returns the name of a struct field in the request: its JSON name, or the name of the parameter it is bound to.
+func fieldName(field reflect.StructField) string {
+	tag, ok := field.Tag.Lookup("json")
+	for _, in := range paramSources {
+		if ok {
+			break
+		}
+		tag, ok = field.Tag.Lookup(in)
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
+
+//escapePointer escapes a JSON pointer reference token.
+var escapePointer = strings.NewReplacer("~", "~0", "/", "~1").Replace
@@ -0,0 +1,200 @@
+package pastis
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+type signupAddress struct {
+	City string `json:"city" validate:"required"`
+	Zip  string `json:"zip" validate:"regexp=^[0-9]{5}$"`
+}
+
+type signup struct {
+	Name      string                   `json:"name" validate:"required,min=2,max=5"`
+	Email     string                   `json:"email" validate:"email"`
+	Age       int                      `json:"age" validate:"min=18,max=130"`
+	Plan      string                   `json:"plan" validate:"enum=free|pro"`
+	Code      string                   `json:"code" validate:"len=4"`
+	Nickname  *string                  `json:"nickname" validate:"required,regexp=^[a-z]{1,3}$"`
+	Tags      []string                 `json:"tags" validate:"max=2,dive,min=2"`
+	Addresses []signupAddress          `json:"addresses" validate:"required,dive"`
+	Scores    map[string]int           `json:"scores" validate:"dive,max=10"`
+	Billing   *signupAddress           `json:"billing"`
+	Contacts  map[string]signupAddress `json:"contacts" validate:"dive"`
+}
+
+func (s signup) Validate() error {
+	if s.Plan == "pro" && s.Billing == nil {
+		return Violations{{Pointer: "/billing", Detail: "is required by the pro plan"}}
+	}
+	return nil
+}
+
+type signupParams struct {
+	Referrer string `query:"ref" validate:"required"`
+	Limit    int    `query:"limit,default=20" validate:"max=50"`
+}
+
+func (p *signupParams) Validate() error {
+	if p.Referrer == "self" {
+		return errors.New("cannot refer oneself")
+	}
+	return nil
+}
+
+type category struct {
+	Name     string     `validate:"required"`
+	Children []category `validate:"dive"`
+}
+
+func Test_Pastis_Validation_Rules(t *testing.T) {
+	validator, err := newValidator(reflect.TypeOf(signup{}))
+	expect(t, err, nil)
+
+	var valid signup
+	json.Unmarshal([]byte(`{"name":"ann","email":"ann@example.com","age":30,"plan":"free","nickname":"an","addresses":[{"city":"Paris"}]}`), &valid)
+	var violations Violations
+	validator(unsafe.Pointer(&valid), "", &violations)
+	expect(t, len(violations), 0)
+
+	var invalid signup
+	json.Unmarshal([]byte(`{"name":"a","email":"ann","age":12,"plan":"pro","code":"12345","nickname":"a,b","tags":["a","bb","c"],
+		"addresses":[{"city":"Paris","zip":"7500"},{"zip":"75001"}],"scores":{"a/b":11},"contacts":{"home":{"zip":"1"}}}`), &invalid)
+	violations = nil
+	validator(unsafe.Pointer(&invalid), "", &violations)
+	expected := Violations{
+		{Pointer: "/name", Detail: "must be at least 2 characters"},
+		{Pointer: "/email", Detail: "must be an email address"},
+		{Pointer: "/age", Detail: "must be at least 18"},
+		{Pointer: "/code", Detail: "must have exactly 4 characters"},
+		{Pointer: "/nickname", Detail: "must match ^[a-z]{1,3}$"},
+		{Pointer: "/tags", Detail: "must be at most 2 elements"},
+		{Pointer: "/tags/0", Detail: "must be at least 2 characters"},
+		{Pointer: "/tags/2", Detail: "must be at least 2 characters"},
+		{Pointer: "/addresses/0/zip", Detail: "must match ^[0-9]{5}$"},
+		{Pointer: "/addresses/1/city", Detail: "is required"},
+		{Pointer: "/scores/a~1b", Detail: "must be at most 10"},
+		{Pointer: "/contacts/home/city", Detail: "is required"},
+		{Pointer: "/contacts/home/zip", Detail: "must match ^[0-9]{5}$"},
+		{Pointer: "/billing", Detail: "is required by the pro plan"},
+	}
+	expect(t, len(violations), len(expected))
+	for i := range expected {
+		if i < len(violations) {
+			expect(t, violations[i], expected[i])
+		}
+	}
+
+	validator, err = newValidator(reflect.TypeOf(category{}))
+	expect(t, err, nil)
+	violations = nil
+	root := category{"root", []category{{"a", nil}, {"", []category{{}}}}}
+	validator(unsafe.Pointer(&root), "", &violations)
+	expect(t, violations.Error(), "/Children/1/Name is required, /Children/1/Children/0/Name is required")
+
+	for _, invalidType := range []interface{}{
+		struct {
+			A bool `validate:"min=1"`
+		}{},
+		struct {
+			A int `validate:"len=1"`
+		}{},
+		struct {
+			A string `validate:"regexp=["`
+		}{},
+		struct {
+			A string `validate:"dive"`
+		}{},
+		struct {
+			A string `validate:"unique"`
+		}{},
+		struct {
+			A []int `validate:"dive,email"`
+		}{},
+	} {
+		_, err = newValidator(reflect.TypeOf(invalidType))
+		refute(t, err, nil)
+	}
+}
+
+type priority uint8
+
+func (p priority) String() string {
+	return [...]string{"low", "normal", "high"}[p%3]
+}
+
+type layoutRules struct {
+	Small    int8              `validate:"min=-2"`
+	Ratio    float32           `validate:"max=0.5"`
+	Count    uint16            `validate:"min=10"`
+	Priority priority          `validate:"enum=normal|high"`
+	Grid     [2]string         `validate:"len=2,dive,enum=a|b"`
+	Owner    signupAddress     `validate:"required"`
+	Labels   map[string]string `validate:"max=1"`
+	Backup   *[2]int           `validate:"dive,max=9"`
+}
+
+func Test_Pastis_Validation_Layouts(t *testing.T) {
+	validator, err := newValidator(reflect.TypeOf(layoutRules{}))
+	expect(t, err, nil)
+
+	valid := layoutRules{-2, 0.5, 10, 2, [2]string{"a", "b"}, signupAddress{Zip: ""}, map[string]string{"a": "b"}, &[2]int{1, 9}}
+	var violations Violations
+	validator(unsafe.Pointer(&valid), "", &violations)
+	expect(t, violations.Error(), "/Owner is required")
+
+	valid.Owner.City = "Paris"
+	violations = nil
+	validator(unsafe.Pointer(&valid), "", &violations)
+	expect(t, len(violations), 0)
+
+	invalid := layoutRules{-3, 0.75, 9, 0, [2]string{"a", "c"}, signupAddress{City: "Paris"}, map[string]string{"a": "b", "c": "d"}, &[2]int{1, 10}}
+	violations = nil
+	validator(unsafe.Pointer(&invalid), "", &violations)
+	expect(t, violations.Error(), "/Small must be at least -2, /Ratio must be at most 0.5, /Count must be at least 10, "+
+		"/Priority must be one of normal, high, /Grid/1 must be one of a, b, /Labels must be at most 1 elements, /Backup/1 must be at most 9")
+}
+
+func Test_Pastis_Validation_Responses(t *testing.T) {
+	p := NewAPI()
+	p.Post("/signups", func(params signupParams, s signup) (int, interface{}) {
+		return http.StatusCreated, Foo{s.Name, params.Limit}
+	})
+	refute(t, p.Post("/invalid", func(s struct {
+		Name string `validate:"unknown"`
+	}) (int, interface{}) {
+		return http.StatusOK, nil
+	}), nil)
+	p.HandleFunc()
+
+	body := `{"name":"ann","email":"ann@example.com","age":30,"plan":"free","nickname":"an","addresses":[{"city":"Paris"}]}`
+	assert_Foo_Response(t, callbackRequest(p, "POST", "/signups?ref=bob", body).Result(), http.StatusCreated, Foo{"ann", 20})
+
+	rw := callbackRequest(p, "POST", "/signups?limit=60", `{"name":"ann","email":"ann@example.com","age":30,"plan":"gold","nickname":"an","addresses":[]}`)
+	var problem struct {
+		Status     int
+		Code       string
+		Violations Violations
+	}
+	json.Unmarshal(rw.Body.Bytes(), &problem)
+	expect(t, rw.Code, http.StatusUnprocessableEntity)
+	expect(t, rw.Header().Get("Content-Type"), MediaTypeProblem)
+	expect(t, problem.Code, "invalid_request")
+	expect(t, len(problem.Violations), 4)
+	expect(t, problem.Violations[0], Violation{"query", "/ref", "is required"})
+	expect(t, problem.Violations[1], Violation{"query", "/limit", "must be at most 50"})
+	expect(t, problem.Violations[2], Violation{"body", "/plan", "must be one of free, pro"})
+	expect(t, problem.Violations[3], Violation{"body", "/addresses", "is required"})
+
+	rw = callbackRequest(p, "POST", "/signups?ref=self", body)
+	problem.Violations = nil
+	json.Unmarshal(rw.Body.Bytes(), &problem)
+	expect(t, rw.Code, http.StatusUnprocessableEntity)
+	expect(t, len(problem.Violations), 1)
+	expect(t, problem.Violations[0], Violation{"", "", "cannot refer oneself"})
+}